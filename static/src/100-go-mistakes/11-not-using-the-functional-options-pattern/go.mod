@@ -0,0 +1,3 @@
+module m11
+
+go 1.22.5
@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 type Config struct {
@@ -39,7 +41,8 @@ func (b *ConfigBuilder) Build() (Config, error) {
 
 // functional options allows for handling optional configurations
 type options struct {
-	port *int
+	port    *int
+	handler http.Handler
 }
 
 type Option func(options *options) error
@@ -54,6 +57,16 @@ func WithPort(port int) Option {
 	}
 }
 
+func WithHandler(handler http.Handler) Option {
+	return func(options *options) error {
+		if handler == nil {
+			return errors.New("handler should not be nil")
+		}
+		options.handler = handler
+		return nil
+	}
+}
+
 func NewServer(addr string, opts ...Option) (*http.Server, error) {
 	var options options
 	for _, opt := range opts {
@@ -72,10 +85,15 @@ func NewServer(addr string, opts ...Option) (*http.Server, error) {
 		port = *options.port
 	}
 
-	// ...
+	handler := options.handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
 
-	_ = port
-	return nil, nil
+	return &http.Server{
+		Addr:    net.JoinHostPort(addr, strconv.Itoa(port)),
+		Handler: handler,
+	}, nil
 }
 
 func main() {
@@ -84,5 +102,5 @@ func main() {
 	_, _ = builder.Build()
 
 	_, _ = NewServer("localhost")
-	_, _ = NewServer("localhost", WithPort(9000))
+	_, _ = NewServer("localhost", WithPort(9000), WithHandler(http.NotFoundHandler()))
 }
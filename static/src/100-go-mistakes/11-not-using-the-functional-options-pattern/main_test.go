@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNewServer(t *testing.T) {
+	for _, test := range []struct {
+		opts []Option
+		addr string
+	}{
+		{nil, "localhost:8000"},
+		{[]Option{WithPort(0)}, "localhost:7000"},
+		{[]Option{WithPort(9000)}, "localhost:9000"},
+	} {
+		s, err := NewServer("localhost", test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Addr != test.addr {
+			t.Errorf("addr %s, want %s", s.Addr, test.addr)
+		}
+		if s.Handler != http.DefaultServeMux {
+			t.Errorf("handler %v, want the default mux", s.Handler)
+		}
+	}
+
+	handler := http.NotFoundHandler()
+	s, err := NewServer("localhost", WithHandler(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Handler == nil || s.Handler == http.DefaultServeMux {
+		t.Error("WithHandler was ignored")
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	if _, err := NewServer("localhost", WithPort(-1)); err == nil {
+		t.Error("expected an error for a negative port")
+	}
+	if _, err := NewServer("localhost", WithHandler(nil)); err == nil {
+		t.Error("expected an error for a nil handler")
+	}
+}
@@ -0,0 +1,3 @@
+module m34
+
+go 1.22.5
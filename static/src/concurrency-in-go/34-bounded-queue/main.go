@@ -0,0 +1,251 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// a bounded queue generalizes the two-slot queue built with sync.Cond: producers block while the queue is full and consumers block while it is empty
+
+// unlike Cond.Wait(), a blocked Push() or Pop() can be abandoned through a context, and Close() wakes every goroutine that is still waiting
+
+// blocked producers and consumers are kept in FIFO order and slots are handed directly to the goroutine that has been waiting the longest, so a newly arriving goroutine can never barge ahead of one that is already waiting
+
+var (
+	ErrClosed = errors.New("queue closed")
+	ErrFull   = errors.New("queue full")
+	ErrEmpty  = errors.New("queue empty")
+)
+
+type waiter[T any] struct {
+	v     T
+	err   error
+	ready chan struct{}
+}
+
+type BoundedQueue[T any] struct {
+	mu sync.Mutex
+
+	// the items are stored in a ring buffer so that popping does not reslice
+	buf  []T
+	head int
+	size int
+
+	producers list.List // *waiter[T] blocked in Push()
+	consumers list.List // *waiter[T] blocked in Pop()
+
+	closed bool
+}
+
+func NewBoundedQueue[T any](capacity int) *BoundedQueue[T] {
+	if capacity <= 0 {
+		panic("capacity must be positive")
+	}
+	return &BoundedQueue[T]{buf: make([]T, capacity)}
+}
+
+func (q *BoundedQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+func (q *BoundedQueue[T]) Cap() int {
+	return len(q.buf)
+}
+
+func (q *BoundedQueue[T]) enqueue(v T) {
+	q.buf[(q.head+q.size)%len(q.buf)] = v
+	q.size++
+}
+
+func (q *BoundedQueue[T]) dequeue() T {
+	var zero T
+	v := q.buf[q.head]
+	q.buf[q.head] = zero // do not retain a reference to the popped item
+	q.head = (q.head + 1) % len(q.buf)
+	q.size--
+	return v
+}
+
+// tryPush must be called with the lock held
+func (q *BoundedQueue[T]) tryPush(v T) error {
+	if q.closed {
+		return ErrClosed
+	}
+
+	// a waiting consumer implies the buffer is empty so the item can be handed over directly
+	if e := q.consumers.Front(); e != nil {
+		w := q.consumers.Remove(e).(*waiter[T])
+		w.v = v
+		close(w.ready)
+		return nil
+	}
+
+	if q.size < len(q.buf) && q.producers.Len() == 0 {
+		q.enqueue(v)
+		return nil
+	}
+	return ErrFull
+}
+
+// tryPop must be called with the lock held
+func (q *BoundedQueue[T]) tryPop() (T, error) {
+	var zero T
+	if q.size == 0 {
+		if q.closed {
+			return zero, ErrClosed
+		}
+		return zero, ErrEmpty
+	}
+
+	v := q.dequeue()
+
+	// the freed slot goes to the producer that has been waiting the longest
+	if e := q.producers.Front(); e != nil {
+		w := q.producers.Remove(e).(*waiter[T])
+		q.enqueue(w.v)
+		close(w.ready)
+	}
+	return v, nil
+}
+
+func (q *BoundedQueue[T]) TryPush(v T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tryPush(v)
+}
+
+func (q *BoundedQueue[T]) TryPop() (T, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tryPop()
+}
+
+// wait blocks until w is handed off or ctx is done; if ctx wins the race the waiter is removed from its list
+func (q *BoundedQueue[T]) wait(ctx context.Context, l *list.List, e *list.Element, w *waiter[T]) error {
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// the hand-off may have happened between ctx.Done() firing and acquiring the lock
+	select {
+	case <-w.ready:
+		return w.err
+	default:
+	}
+
+	l.Remove(e)
+	return ctx.Err()
+}
+
+func (q *BoundedQueue[T]) Push(ctx context.Context, v T) error {
+	q.mu.Lock()
+	if err := q.tryPush(v); err != ErrFull {
+		q.mu.Unlock()
+		return err
+	}
+
+	w := &waiter[T]{v: v, ready: make(chan struct{})}
+	e := q.producers.PushBack(w)
+	q.mu.Unlock()
+
+	return q.wait(ctx, &q.producers, e, w)
+}
+
+func (q *BoundedQueue[T]) Pop(ctx context.Context) (T, error) {
+	q.mu.Lock()
+	if v, err := q.tryPop(); err != ErrEmpty {
+		q.mu.Unlock()
+		return v, err
+	}
+
+	w := &waiter[T]{ready: make(chan struct{})}
+	e := q.consumers.PushBack(w)
+	q.mu.Unlock()
+
+	if err := q.wait(ctx, &q.consumers, e, w); err != nil {
+		var zero T
+		return zero, err
+	}
+	return w.v, nil
+}
+
+func (q *BoundedQueue[T]) PushTimeout(v T, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.Push(ctx, v)
+}
+
+func (q *BoundedQueue[T]) PopTimeout(timeout time.Duration) (T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.Pop(ctx)
+}
+
+// Close wakes all blocked producers and consumers with ErrClosed; items already in the queue can still be popped
+func (q *BoundedQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+
+	for _, l := range []*list.List{&q.producers, &q.consumers} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			w := e.Value.(*waiter[T])
+			w.err = ErrClosed
+			close(w.ready)
+		}
+		l.Init()
+	}
+}
+
+func main() {
+	// the same two-slot queue as in the sync.Cond example
+	q := NewBoundedQueue[int](2)
+	ctx := context.Background()
+
+	pop := func(delay time.Duration) {
+		time.Sleep(delay)
+		v, err := q.Pop(ctx)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Popped", v)
+	}
+
+	// Push() only returns once there is room in the queue
+	for i := 0; i < 10; i++ {
+		if err := q.Push(ctx, i); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("Pushed", i)
+		go pop(1 * time.Second)
+	}
+
+	// the queue is full so a non-blocking push fails immediately
+	fmt.Println(q.TryPush(10))
+
+	// give up on a push that does not succeed within the timeout
+	fmt.Println(q.PushTimeout(10, 10*time.Millisecond))
+
+	time.Sleep(2 * time.Second)
+	q.Close()
+
+	_, err := q.Pop(ctx)
+	fmt.Println(err)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBoundedQueueFIFO(t *testing.T) {
+	q := NewBoundedQueue[int](3)
+
+	// wrap around the ring buffer a few times
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 3; i++ {
+			if err := q.TryPush(round*10 + i); err != nil {
+				t.Fatalf("TryPush: %v", err)
+			}
+		}
+		if err := q.TryPush(-1); err != ErrFull {
+			t.Fatalf("TryPush on full queue = %v, want ErrFull", err)
+		}
+		for i := 0; i < 3; i++ {
+			v, err := q.TryPop()
+			if err != nil || v != round*10+i {
+				t.Fatalf("TryPop = %v, %v, want %v", v, err, round*10+i)
+			}
+		}
+		if _, err := q.TryPop(); err != ErrEmpty {
+			t.Fatalf("TryPop on empty queue = %v, want ErrEmpty", err)
+		}
+	}
+}
+
+func TestBoundedQueueBlocking(t *testing.T) {
+	q := NewBoundedQueue[string](1)
+	ctx := context.Background()
+
+	popped := make(chan string)
+	go func() {
+		v, _ := q.Pop(ctx)
+		popped <- v
+	}()
+
+	// the consumer blocks until something is pushed
+	select {
+	case v := <-popped:
+		t.Fatalf("Pop returned %q before Push", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := q.Push(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-popped; v != "a" {
+		t.Fatalf("Pop = %q, want a", v)
+	}
+
+	if err := q.Push(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	pushed := make(chan error)
+	go func() { pushed <- q.Push(ctx, "c") }()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push returned while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if v, _ := q.Pop(ctx); v != "b" {
+		t.Fatalf("Pop = %q, want b", v)
+	}
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := q.Pop(ctx); v != "c" {
+		t.Fatalf("Pop = %q, want c", v)
+	}
+}
+
+func TestBoundedQueueCancel(t *testing.T) {
+	q := NewBoundedQueue[int](1)
+
+	if _, err := q.PopTimeout(10 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PopTimeout = %v, want DeadlineExceeded", err)
+	}
+
+	q.TryPush(1)
+	if err := q.PushTimeout(2, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("PushTimeout = %v, want DeadlineExceeded", err)
+	}
+
+	// the abandoned push must not have been enqueued
+	q.TryPop()
+	if _, err := q.TryPop(); err != ErrEmpty {
+		t.Fatalf("TryPop = %v, want ErrEmpty", err)
+	}
+}
+
+func TestBoundedQueueClose(t *testing.T) {
+	q := NewBoundedQueue[int](1)
+	ctx := context.Background()
+	q.TryPush(1)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- q.Push(ctx, 2)
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	q.Close()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != ErrClosed {
+			t.Fatalf("Push = %v, want ErrClosed", err)
+		}
+	}
+
+	// remaining items are drained before Pop reports the queue as closed
+	if v, err := q.Pop(ctx); err != nil || v != 1 {
+		t.Fatalf("Pop = %v, %v, want 1", v, err)
+	}
+	if _, err := q.Pop(ctx); err != ErrClosed {
+		t.Fatalf("Pop = %v, want ErrClosed", err)
+	}
+}
+
+func TestBoundedQueueProducerFairness(t *testing.T) {
+	q := NewBoundedQueue[int](1)
+	ctx := context.Background()
+	q.TryPush(0)
+
+	// start the producers one at a time so their arrival order is known
+	for i := 1; i <= 5; i++ {
+		go q.Push(ctx, i)
+		for {
+			q.mu.Lock()
+			n := q.producers.Len()
+			q.mu.Unlock()
+			if n == i {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// a late non-blocking push cannot overtake the waiting producers
+	for i := 0; i <= 5; i++ {
+		if err := q.TryPush(100); err != ErrFull {
+			t.Fatalf("TryPush = %v, want ErrFull", err)
+		}
+		v, err := q.Pop(ctx)
+		if err != nil || v != i {
+			t.Fatalf("Pop = %v, %v, want %v", v, err, i)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCondSignalOrder(t *testing.T) {
+	c := NewCond(&sync.Mutex{})
+	woken := make(chan int, 3)
+
+	for i := 0; i < 3; i++ {
+		c.L.Lock()
+		go func(i int) {
+			c.L.Lock()
+			defer c.L.Unlock()
+			if err := c.Wait(context.Background()); err != nil {
+				t.Error(err)
+			}
+			woken <- i
+		}(i)
+		// wait for the goroutine to be registered
+		for {
+			c.mu.Lock()
+			n := c.waiters.Len()
+			c.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			c.L.Unlock()
+			time.Sleep(time.Millisecond)
+			c.L.Lock()
+		}
+		c.L.Unlock()
+	}
+
+	for i := 0; i < 3; i++ {
+		c.Signal()
+		if got := <-woken; got != i {
+			t.Fatalf("woke %d, want %d", got, i)
+		}
+	}
+}
+
+func TestCondWaitCancelled(t *testing.T) {
+	var mu sync.Mutex
+	c := NewCond(&mu)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	mu.Lock()
+	err := c.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want DeadlineExceeded", err)
+	}
+
+	// the lock must be held again after a cancelled Wait
+	if mu.TryLock() {
+		t.Fatal("lock was not reacquired")
+	}
+	mu.Unlock()
+
+	if c.waiters.Len() != 0 {
+		t.Fatalf("%d waiters left behind", c.waiters.Len())
+	}
+}
+
+// many consumers wait for items with random timeouts while producers signal; every item must be consumed exactly once and every goroutine must exit
+func TestCondStress(t *testing.T) {
+	const (
+		producers = 8
+		consumers = 16
+		items     = 2000
+	)
+
+	var mu sync.Mutex
+	c := NewCond(&mu)
+	queue := 0
+	consumed := 0
+	done := false
+
+	var wg sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for queue == 0 && !done {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Intn(100))*time.Microsecond)
+					err := c.Wait(ctx)
+					cancel()
+					if err != nil && err != context.DeadlineExceeded {
+						t.Error(err)
+						return
+					}
+				}
+				if queue == 0 && done {
+					return
+				}
+				queue--
+				consumed++
+			}
+		}(int64(i))
+	}
+
+	var pwg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		pwg.Add(1)
+		go func() {
+			defer pwg.Done()
+			for j := 0; j < items/producers; j++ {
+				mu.Lock()
+				queue++
+				mu.Unlock()
+				if j%2 == 0 {
+					c.Signal()
+				} else {
+					c.Broadcast()
+				}
+			}
+		}()
+	}
+	pwg.Wait()
+
+	mu.Lock()
+	done = true
+	mu.Unlock()
+	c.Broadcast()
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("consumers did not exit")
+	}
+
+	if consumed != items {
+		t.Fatalf("consumed %d items, want %d", consumed, items)
+	}
+}
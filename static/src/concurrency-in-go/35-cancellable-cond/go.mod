@@ -0,0 +1,3 @@
+module m35
+
+go 1.22.5
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sync.Cond.Wait() cannot be interrupted, so a goroutine waiting for a signal that never comes is leaked forever
+
+// this condition variable has the same semantics but each waiter parks on its own channel, which lets Wait() also select on ctx.Done()
+
+// as with sync.Cond, L is unlocked while waiting and is always locked again before Wait() returns, even when the context was cancelled
+
+type Cond struct {
+	L sync.Locker
+
+	mu      sync.Mutex
+	waiters list.List // chan struct{} per waiting goroutine, oldest first
+}
+
+func NewCond(l sync.Locker) *Cond {
+	return &Cond{L: l}
+}
+
+// Wait returns nil when woken by Signal() or Broadcast() and ctx.Err() when the context is done first
+func (c *Cond) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ch := make(chan struct{})
+	c.mu.Lock()
+	e := c.waiters.PushBack(ch)
+	c.mu.Unlock()
+
+	c.L.Unlock()
+	defer c.L.Lock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a signal that raced with the cancellation has already been delivered to us; report the wake-up rather than losing it
+	select {
+	case <-ch:
+		return nil
+	default:
+	}
+
+	c.waiters.Remove(e)
+	return ctx.Err()
+}
+
+// Signal wakes the goroutine that has been waiting the longest, if any
+func (c *Cond) Signal() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e := c.waiters.Front(); e != nil {
+		close(c.waiters.Remove(e).(chan struct{}))
+	}
+}
+
+// Broadcast wakes all waiting goroutines
+func (c *Cond) Broadcast() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.waiters.Front(); e != nil; e = e.Next() {
+		close(e.Value.(chan struct{}))
+	}
+	c.waiters.Init()
+}
+
+type Button struct {
+	Clicked *Cond
+}
+
+// the subscriber now gives up when ctx is done instead of waiting forever for a click
+func subscribe(ctx context.Context, c *Cond, f func(), onCancel func(error)) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		c.L.Lock()
+		defer c.L.Unlock()
+
+		// the waiter is registered before L is released, so a broadcast made while holding L cannot be missed once subscribe returns
+		wg.Done()
+		if err := c.Wait(ctx); err != nil {
+			onCancel(err)
+			return
+		}
+		f()
+	}()
+
+	wg.Wait()
+}
+
+func main() {
+	button := Button{
+		Clicked: NewCond(&sync.Mutex{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	subscribe(ctx, button.Clicked, func() {
+		fmt.Println("Maximizing window")
+		wg.Done()
+	}, func(err error) {
+		fmt.Println("Maximizing window:", err)
+		wg.Done()
+	})
+
+	subscribe(ctx, button.Clicked, func() {
+		fmt.Println("Displaying dialog box")
+		wg.Done()
+	}, func(err error) {
+		fmt.Println("Displaying dialog box:", err)
+		wg.Done()
+	})
+
+	// no one clicks the button so both subscribers time out rather than leak
+	wg.Wait()
+
+	wg.Add(1)
+	subscribe(context.Background(), button.Clicked, func() {
+		fmt.Println("Submit form")
+		wg.Done()
+	}, func(err error) {
+		wg.Done()
+	})
+
+	button.Clicked.L.Lock()
+	button.Clicked.Broadcast()
+	button.Clicked.L.Unlock()
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSyncDelivery(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	topic := NewTopic[int]("numbers")
+
+	var got []int
+	Subscribe(bus, topic, func(n int) { got = append(got, n) })
+	for i := range 3 {
+		Publish(bus, topic, i)
+	}
+
+	// a synchronous handler has run by the time Publish returns
+	if len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestAsyncDeliveryInOrder(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	topic := NewTopic[int]("numbers")
+
+	const n = 100
+	received := make(chan int, n)
+	Subscribe(bus, topic, func(v int) { received <- v }, Async(4))
+	for i := range n {
+		Publish(bus, topic, i)
+	}
+
+	for i := range n {
+		select {
+		case v := <-received:
+			if v != i {
+				t.Fatalf("got %d, want %d", v, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d was not delivered", i)
+		}
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	topic := NewTopic[string]("words")
+
+	var mu sync.Mutex
+	var panics []string
+	recovered := make(chan struct{}, 2)
+	bus.OnPanic = func(topic string, r any) {
+		mu.Lock()
+		defer mu.Unlock()
+		panics = append(panics, topic+": "+r.(string))
+		recovered <- struct{}{}
+	}
+
+	var delivered atomic.Int64
+	Subscribe(bus, topic, func(s string) { panic(s) })
+	Subscribe(bus, topic, func(s string) { panic(s) }, Async(1))
+	Subscribe(bus, topic, func(s string) { delivered.Add(1) })
+
+	Publish(bus, topic, "boom")
+	for range 2 {
+		select {
+		case <-recovered:
+		case <-time.After(time.Second):
+			t.Fatal("panic was not reported")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the panics were recovered and the other subscriber still got the event
+	if delivered.Load() != 1 {
+		t.Fatal("event was not delivered after a handler panicked")
+	}
+	if len(panics) != 2 || panics[0] != "words: boom" || panics[1] != "words: boom" {
+		t.Fatalf("OnPanic got %v", panics)
+	}
+}
+
+func TestCloseWaitsForAsyncHandlers(t *testing.T) {
+	bus := NewBus()
+	topic := NewTopic[int]("numbers")
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	Subscribe(bus, topic, func(int) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	}, Async(1))
+
+	Publish(bus, topic, 1)
+	<-started
+	bus.Close()
+	if !finished.Load() {
+		t.Fatal("Close returned while a handler was running")
+	}
+
+	// later subscriptions and events go nowhere
+	called := false
+	Subscribe(bus, topic, func(int) { called = true })
+	Publish(bus, topic, 2)
+	if called {
+		t.Fatal("subscription after Close got an event")
+	}
+}
+
+func TestTypeMismatchDoesNotLockBus(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(r.(string), "payload") {
+				t.Fatalf("got %v, want a type mismatch panic", r)
+			}
+		}()
+		Subscribe(bus, NewTopic[int]("topic"), func(int) {})
+		Publish(bus, NewTopic[string]("topic"), "wrong")
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Publish(bus, NewTopic[int]("topic"), 1)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("bus stayed locked after a panic")
+	}
+}
@@ -0,0 +1,3 @@
+module m36
+
+go 1.22.5
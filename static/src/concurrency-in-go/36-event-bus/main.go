@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// a Cond broadcast only reaches goroutines that happen to be waiting at that moment and each waiter handles a single signal, so a second click on the button would be lost
+
+// an event bus instead keeps a list of subscriptions per topic and delivers every published event to every subscription until it is cancelled
+
+// a topic is named and carries a payload type so that publishers and handlers agree on what is sent at compile time
+
+// events are delivered to each subscription in the order they were published; a synchronous subscription runs its handler inside Publish() whereas an asynchronous subscription has its own goroutine and buffer
+
+type Topic[T any] struct {
+	name string
+}
+
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+type Bus struct {
+	mu     sync.Mutex
+	types  map[string]reflect.Type
+	subs   map[string][]*Subscription
+	closed bool
+	async  sync.WaitGroup // goroutines of asynchronous subscriptions
+
+	// OnPanic is called when a handler panics; the panic is recovered so that one bad handler cannot take down the publisher or other subscribers
+	OnPanic func(topic string, r any)
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		types: make(map[string]reflect.Type),
+		subs:  make(map[string][]*Subscription),
+		OnPanic: func(topic string, r any) {
+			fmt.Printf("handler for %q panicked: %v\n", topic, r)
+		},
+	}
+}
+
+type Subscription struct {
+	bus     *Bus
+	topic   string
+	handler func(any)
+
+	// events is nil for synchronous subscriptions
+	events chan any
+	quit   chan struct{}
+	once   sync.Once
+}
+
+type subscribeOptions struct {
+	async  bool
+	buffer int
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+// Async delivers events on a dedicated goroutine; Publish() blocks once buffer events are pending for this subscription
+func Async(buffer int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.async = true
+		o.buffer = buffer
+	}
+}
+
+// a topic name must always be used with the same payload type
+func (b *Bus) checkType(topic string, typ reflect.Type) {
+	if existing, ok := b.types[topic]; ok && existing != typ {
+		panic(fmt.Sprintf("topic %q used with payload %v and %v", topic, existing, typ))
+	}
+	b.types[topic] = typ
+}
+
+func Subscribe[T any](b *Bus, t Topic[T], handler func(T), opts ...SubscribeOption) *Subscription {
+	var o subscribeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &Subscription{
+		bus:     b,
+		topic:   t.name,
+		handler: func(v any) { handler(v.(T)) },
+		quit:    make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkType(t.name, reflect.TypeOf((*T)(nil)).Elem())
+	if b.closed {
+		close(s.quit)
+		return s
+	}
+
+	if o.async {
+		s.events = make(chan any, o.buffer)
+		b.async.Add(1)
+		go s.loop()
+	}
+	b.subs[t.name] = append(b.subs[t.name], s)
+	return s
+}
+
+func Publish[T any](b *Bus, t Topic[T], v T) {
+	for _, s := range b.subscribers(t.name, reflect.TypeOf((*T)(nil)).Elem()) {
+		s.deliver(v)
+	}
+}
+
+// subscribers returns a copy of the subscriptions to topic, so that handlers may subscribe or cancel without deadlocking
+func (b *Bus) subscribers(topic string, typ reflect.Type) []*Subscription {
+	b.mu.Lock()
+	// checkType panics on a mismatch, which must not leave the bus locked
+	defer b.mu.Unlock()
+
+	b.checkType(topic, typ)
+	return append([]*Subscription(nil), b.subs[topic]...)
+}
+
+func (s *Subscription) deliver(v any) {
+	if s.events == nil {
+		select {
+		case <-s.quit:
+		default:
+			s.call(v)
+		}
+		return
+	}
+
+	select {
+	case <-s.quit:
+	case s.events <- v:
+	}
+}
+
+func (s *Subscription) loop() {
+	defer s.bus.async.Done()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case v := <-s.events:
+			// select picks randomly so check for cancellation before every call
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.call(v)
+		}
+	}
+}
+
+func (s *Subscription) call(v any) {
+	defer func() {
+		if r := recover(); r != nil && s.bus.OnPanic != nil {
+			s.bus.OnPanic(s.topic, r)
+		}
+	}()
+	s.handler(v)
+}
+
+// Cancel stops delivery to the subscription; events still buffered for an asynchronous subscription are dropped
+func (s *Subscription) Cancel() {
+	s.once.Do(func() {
+		close(s.quit)
+
+		b := s.bus
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		subs := b.subs[s.topic]
+		for i, other := range subs {
+			if other == s {
+				b.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+// Close cancels every subscription and waits for the handlers of asynchronous subscriptions that are still running to return, so it must not be called from such a handler; later subscriptions are cancelled immediately
+func (b *Bus) Close() {
+	b.mu.Lock()
+	b.closed = true
+	var all []*Subscription
+	for _, subs := range b.subs {
+		all = append(all, subs...)
+	}
+	b.mu.Unlock()
+
+	for _, s := range all {
+		s.Cancel()
+	}
+	b.async.Wait()
+}
+
+type Click struct {
+	N  int
+	At time.Time
+}
+
+type Button struct {
+	Clicked Topic[Click]
+	bus     *Bus
+	clicks  int
+}
+
+func NewButton(bus *Bus, name string) *Button {
+	return &Button{Clicked: NewTopic[Click](name + ".clicked"), bus: bus}
+}
+
+func (b *Button) Click() {
+	b.clicks++
+	Publish(b.bus, b.Clicked, Click{N: b.clicks, At: time.Now()})
+}
+
+func main() {
+	bus := NewBus()
+	defer bus.Close()
+
+	button := NewButton(bus, "submit")
+
+	const clicks = 3
+	var wg sync.WaitGroup
+	wg.Add(3 * clicks)
+
+	// every subscriber now handles every click instead of only the first one
+	Subscribe(bus, button.Clicked, func(c Click) {
+		defer wg.Done()
+		fmt.Println("Maximizing window", c.N)
+	}, Async(8))
+
+	Subscribe(bus, button.Clicked, func(c Click) {
+		defer wg.Done()
+		if c.N == 2 {
+			panic("dialog box is broken")
+		}
+		fmt.Println("Displaying dialog box", c.N)
+	}, Async(8))
+
+	Subscribe(bus, button.Clicked, func(c Click) {
+		defer wg.Done()
+		fmt.Println("Submit form", c.N)
+	})
+
+	for i := 0; i < clicks; i++ {
+		button.Click()
+	}
+	wg.Wait()
+
+	// a cancelled subscription no longer sees clicks
+	sub := Subscribe(bus, button.Clicked, func(c Click) {
+		defer wg.Done()
+		fmt.Println("Logging click", c.N)
+	})
+
+	wg.Add(4)
+	button.Click()
+	wg.Wait()
+
+	sub.Cancel()
+
+	wg.Add(3)
+	button.Click()
+	wg.Wait()
+}
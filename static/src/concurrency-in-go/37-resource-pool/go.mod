@@ -0,0 +1,3 @@
+module m37
+
+go 1.22.5
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sync.Pool is a cache rather than a limit: it creates as many objects as are asked for and may drop idle objects at any garbage collection
+
+// for expensive objects such as database connections we want the opposite: at most MaxSize objects ever exist, callers wait for one to become free, and objects are only discarded when they are broken or too old
+
+// a released resource is handed directly to the goroutine that has been waiting the longest; when a resource is destroyed instead, its slot is handed over so the waiter may create a replacement
+
+var ErrPoolClosed = errors.New("pool closed")
+
+type Config[T any] struct {
+	// New creates a resource; it is called without holding any lock
+	New func(ctx context.Context) (T, error)
+
+	// Close destroys a resource that is evicted, invalid or released after the pool is closed
+	Close func(T)
+
+	// Validate is called before an idle resource is handed out; a resource that fails validation is destroyed
+	Validate func(T) error
+
+	MaxSize     int
+	MaxIdleTime time.Duration // zero means idle resources are kept forever
+	MaxLifetime time.Duration // zero means resources are never too old
+}
+
+type Resource[T any] struct {
+	value      T
+	createdAt  time.Time
+	releasedAt time.Time
+}
+
+func (r *Resource[T]) Value() T {
+	return r.value
+}
+
+type Stats struct {
+	Open         int // in use plus idle
+	InUse        int
+	Idle         int
+	WaitCount    int64         // number of Acquire calls that had to wait
+	WaitDuration time.Duration // total time spent waiting
+}
+
+type ResourcePool[T any] struct {
+	cfg Config[T]
+
+	mu      sync.Mutex
+	idle    []*Resource[T] // most recently released last
+	numOpen int
+	waiters list.List // chan *Resource[T]; a nil resource hands over a slot
+	closed  bool
+
+	waitCount    atomic.Int64
+	waitDuration atomic.Int64
+
+	done chan struct{}
+}
+
+func NewResourcePool[T any](cfg Config[T]) *ResourcePool[T] {
+	if cfg.MaxSize <= 0 {
+		panic("MaxSize must be positive")
+	}
+
+	p := &ResourcePool[T]{cfg: cfg, done: make(chan struct{})}
+
+	if interval := min(nonZero(cfg.MaxIdleTime), nonZero(cfg.MaxLifetime)); interval > 0 && interval < forever {
+		go p.reap(interval / 2)
+	}
+	return p
+}
+
+const forever = time.Duration(1<<63 - 1)
+
+func nonZero(d time.Duration) time.Duration {
+	if d == 0 {
+		return forever
+	}
+	return d
+}
+
+func (p *ResourcePool[T]) expired(r *Resource[T], now time.Time) bool {
+	if p.cfg.MaxLifetime > 0 && now.Sub(r.createdAt) >= p.cfg.MaxLifetime {
+		return true
+	}
+	return p.cfg.MaxIdleTime > 0 && now.Sub(r.releasedAt) >= p.cfg.MaxIdleTime
+}
+
+func (p *ResourcePool[T]) destroy(r *Resource[T]) {
+	if p.cfg.Close != nil {
+		p.cfg.Close(r.value)
+	}
+}
+
+// releaseSlot gives up the slot of a destroyed resource, handing it to a waiter if there is one; it must be called with the lock held
+func (p *ResourcePool[T]) releaseSlot() {
+	if e := p.waiters.Front(); e != nil {
+		p.waiters.Remove(e).(chan *Resource[T]) <- nil
+		return
+	}
+	p.numOpen--
+}
+
+func (p *ResourcePool[T]) create(ctx context.Context) (*Resource[T], error) {
+	v, err := p.cfg.New(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.releaseSlot()
+		p.mu.Unlock()
+		return nil, err
+	}
+	return &Resource[T]{value: v, createdAt: time.Now()}, nil
+}
+
+// checkout validates a resource that is about to be handed out, replacing it with a new one in the same slot if needed
+func (p *ResourcePool[T]) checkout(ctx context.Context, r *Resource[T]) (*Resource[T], error) {
+	if r == nil {
+		return p.create(ctx)
+	}
+	if p.expired(r, time.Now()) || (p.cfg.Validate != nil && p.cfg.Validate(r.value) != nil) {
+		p.destroy(r)
+		return p.create(ctx)
+	}
+	return r, nil
+}
+
+func (p *ResourcePool[T]) Acquire(ctx context.Context) (*Resource[T], error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	if n := len(p.idle); n > 0 {
+		r := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return p.checkout(ctx, r)
+	}
+
+	if p.numOpen < p.cfg.MaxSize {
+		p.numOpen++
+		p.mu.Unlock()
+		return p.create(ctx)
+	}
+
+	ch := make(chan *Resource[T], 1)
+	e := p.waiters.PushBack(ch)
+	p.mu.Unlock()
+
+	start := time.Now()
+	p.waitCount.Add(1)
+
+	select {
+	case r := <-ch:
+		// the wait ends when a resource or a slot is handed over; creating a replacement is not part of it
+		p.waitDuration.Add(int64(time.Since(start)))
+		return p.checkout(ctx, r)
+	case <-ctx.Done():
+	case <-p.done:
+	}
+	p.waitDuration.Add(int64(time.Since(start)))
+
+	p.mu.Lock()
+	select {
+	case r := <-ch:
+		// we were handed a resource or a slot at the same time as giving up, so pass it on
+		p.mu.Unlock()
+		if r == nil {
+			p.mu.Lock()
+			p.releaseSlot()
+			p.mu.Unlock()
+		} else {
+			p.Release(r)
+		}
+	default:
+		p.waiters.Remove(e)
+		p.mu.Unlock()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrPoolClosed
+}
+
+func (p *ResourcePool[T]) Release(r *Resource[T]) {
+	p.mu.Lock()
+	if p.closed {
+		p.numOpen--
+		p.mu.Unlock()
+		// Close may be slow, so like every other callback it runs without the lock
+		p.destroy(r)
+		return
+	}
+	defer p.mu.Unlock()
+
+	r.releasedAt = time.Now()
+	if e := p.waiters.Front(); e != nil {
+		p.waiters.Remove(e).(chan *Resource[T]) <- r
+		return
+	}
+
+	p.idle = append(p.idle, r)
+}
+
+// Discard destroys a resource the caller found to be broken instead of returning it to the pool
+func (p *ResourcePool[T]) Discard(r *Resource[T]) {
+	p.destroy(r)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		p.numOpen--
+		return
+	}
+	p.releaseSlot()
+}
+
+// reap periodically destroys idle resources that have exceeded MaxIdleTime or MaxLifetime
+func (p *ResourcePool[T]) reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		var evicted []*Resource[T]
+
+		p.mu.Lock()
+		kept := p.idle[:0]
+		for _, r := range p.idle {
+			if p.expired(r, now) {
+				evicted = append(evicted, r)
+				p.numOpen--
+			} else {
+				kept = append(kept, r)
+			}
+		}
+		clear(p.idle[len(kept):])
+		p.idle = kept
+		p.mu.Unlock()
+
+		for _, r := range evicted {
+			p.destroy(r)
+		}
+	}
+}
+
+func (p *ResourcePool[T]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Stats{
+		Open:         p.numOpen,
+		InUse:        p.numOpen - len(p.idle),
+		Idle:         len(p.idle),
+		WaitCount:    p.waitCount.Load(),
+		WaitDuration: time.Duration(p.waitDuration.Load()),
+	}
+}
+
+// Close destroys all idle resources and fails pending and future Acquire calls; resources still in use are destroyed when they are released
+func (p *ResourcePool[T]) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+
+	idle := p.idle
+	p.idle = nil
+	p.numOpen -= len(idle)
+	p.mu.Unlock()
+
+	for _, r := range idle {
+		p.destroy(r)
+	}
+}
+
+type Conn struct {
+	ID     int
+	broken atomic.Bool
+}
+
+func main() {
+	var created atomic.Int64
+
+	pool := NewResourcePool(Config[*Conn]{
+		New: func(ctx context.Context) (*Conn, error) {
+			// connecting is expensive
+			time.Sleep(10 * time.Millisecond)
+			id := created.Add(1)
+			fmt.Println("Opening connection", id)
+			return &Conn{ID: int(id)}, nil
+		},
+		Close: func(c *Conn) {
+			fmt.Println("Closing connection", c.ID)
+		},
+		Validate: func(c *Conn) error {
+			if c.broken.Load() {
+				return errors.New("connection broken")
+			}
+			return nil
+		},
+		MaxSize:     2,
+		MaxIdleTime: 200 * time.Millisecond,
+		MaxLifetime: time.Second,
+	})
+	defer pool.Close()
+
+	// ten workers share at most two connections
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			r, err := pool.Acquire(ctx)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			defer pool.Release(r)
+
+			// do something
+			time.Sleep(20 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("%+v\n", pool.Stats())
+
+	// a connection that breaks while in use is replaced on its next borrow; the most recently released connection is handed out first
+	ctx := context.Background()
+	r, err := pool.Acquire(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("Breaking connection", r.Value().ID)
+	r.Value().broken.Store(true)
+	pool.Release(r)
+
+	r, err = pool.Acquire(ctx)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("Borrowed connection", r.Value().ID)
+	pool.Release(r)
+
+	// idle connections are closed once they exceed MaxIdleTime
+	time.Sleep(400 * time.Millisecond)
+	fmt.Printf("%+v\n", pool.Stats())
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conns is a Config whose resources are numbered from 1 and which records the resources it closed
+type conns struct {
+	mu      sync.Mutex
+	created int
+	closed  []int
+	invalid map[int]bool
+}
+
+func (c *conns) config(maxSize int) Config[int] {
+	return Config[int]{
+		New: func(ctx context.Context) (int, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.created++
+			return c.created, nil
+		},
+		Close: func(id int) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.closed = append(c.closed, id)
+		},
+		Validate: func(id int) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.invalid[id] {
+				return errors.New("broken")
+			}
+			return nil
+		},
+		MaxSize: maxSize,
+	}
+}
+
+func (c *conns) closedIds() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.closed...)
+}
+
+func mustAcquire(t *testing.T, p *ResourcePool[int]) *Resource[int] {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := p.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestValidationFailureReplacesResource(t *testing.T) {
+	c := &conns{invalid: make(map[int]bool)}
+	p := NewResourcePool(c.config(1))
+	defer p.Close()
+
+	r := mustAcquire(t, p)
+	p.Release(r)
+	c.mu.Lock()
+	c.invalid[r.Value()] = true
+	c.mu.Unlock()
+
+	r = mustAcquire(t, p)
+	if r.Value() != 2 {
+		t.Fatalf("got resource %d, want a replacement", r.Value())
+	}
+	if closed := c.closedIds(); len(closed) != 1 || closed[0] != 1 {
+		t.Fatalf("closed %v, want the invalid resource", closed)
+	}
+	if s := p.Stats(); s.Open != 1 || s.InUse != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestReapEvictsIdleResources(t *testing.T) {
+	c := &conns{}
+	cfg := c.config(2)
+	cfg.MaxIdleTime = 20 * time.Millisecond
+	p := NewResourcePool(cfg)
+	defer p.Close()
+
+	a, b := mustAcquire(t, p), mustAcquire(t, p)
+	p.Release(a)
+
+	deadline := time.Now().Add(time.Second)
+	for len(c.closedIds()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle resource was not evicted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the resource in use is left alone
+	if closed := c.closedIds(); len(closed) != 1 || closed[0] != a.Value() {
+		t.Fatalf("closed %v, want only %d", closed, a.Value())
+	}
+	if s := p.Stats(); s.Open != 1 || s.Idle != 0 || s.InUse != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+	p.Release(b)
+}
+
+func TestWaitersAreServedInOrder(t *testing.T) {
+	c := &conns{}
+	p := NewResourcePool(c.config(1))
+	defer p.Close()
+
+	held := mustAcquire(t, p)
+
+	const waiters = 5
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := mustAcquire(t, p)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			p.Release(r)
+		}()
+
+		// wait until this waiter is queued before starting the next
+		deadline := time.Now().Add(time.Second)
+		for p.Stats().WaitCount != int64(i+1) {
+			if time.Now().After(deadline) {
+				t.Fatalf("waiter %d did not queue", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	p.Release(held)
+	wg.Wait()
+
+	for i, w := range order {
+		if w != i {
+			t.Fatalf("waiters served in order %v", order)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := &conns{}
+	p := NewResourcePool(c.config(2))
+
+	a, b := mustAcquire(t, p), mustAcquire(t, p)
+	if s := p.Stats(); s.Open != 2 || s.InUse != 2 || s.Idle != 0 || s.WaitCount != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(20 * time.Millisecond)
+		p.Release(a)
+	}()
+	r := mustAcquire(t, p)
+	<-released
+
+	s := p.Stats()
+	if s.WaitCount != 1 || s.WaitDuration < 10*time.Millisecond {
+		t.Fatalf("stats %+v, want one wait of about 20ms", s)
+	}
+
+	p.Release(r)
+	p.Release(b)
+	if s := p.Stats(); s.Open != 2 || s.InUse != 0 || s.Idle != 2 {
+		t.Fatalf("stats %+v", s)
+	}
+
+	p.Close()
+	if s := p.Stats(); s.Open != 0 || len(c.closedIds()) != 2 {
+		t.Fatalf("stats %+v after Close, closed %v", s, c.closedIds())
+	}
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("got %v after Close", err)
+	}
+}
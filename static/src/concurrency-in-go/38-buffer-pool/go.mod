@@ -0,0 +1,3 @@
+module m38
+
+go 1.22.5
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// a single sync.Pool can only hand out one kind of object, so a pool of 1KB buffers is useless to a caller that needs 4KB
+
+// instead we keep one sync.Pool per power-of-two size class; a request is served from the smallest class that fits and the buffer is resliced to the requested length
+
+// New is deliberately left unset on the underlying pools: Get() returning nil tells us the pool was empty, which lets us count hits and misses, and all counters are updated atomically since Get() and Put() are called from many goroutines at once
+
+var (
+	ErrOversized   = errors.New("buffer larger than the largest size class")
+	ErrNotPoolable = errors.New("buffer capacity is not a size class")
+)
+
+type Stats struct {
+	Hits      int64 // served from a size class
+	Misses    int64 // size class was empty
+	Oversized int64 // larger than the largest size class and never pooled
+	Allocs    int64 // buffers allocated, i.e. misses plus oversized
+	Rejected  int64 // buffers refused by Put()
+}
+
+type BufferPool struct {
+	minShift int
+	classes  []sync.Pool
+
+	hits, misses, oversized, rejected atomic.Int64
+}
+
+// NewBufferPool creates size classes for every power of two from minSize up to maxSize, rounding both up to a power of two
+func NewBufferPool(minSize, maxSize int) *BufferPool {
+	if minSize <= 0 || maxSize < minSize {
+		panic("invalid buffer pool sizes")
+	}
+
+	minShift := shift(minSize)
+	return &BufferPool{
+		minShift: minShift,
+		classes:  make([]sync.Pool, shift(maxSize)-minShift+1),
+	}
+}
+
+// shift returns the exponent of the smallest power of two that is at least size
+func shift(size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len(uint(size - 1))
+}
+
+func (p *BufferPool) class(size int) int {
+	return max(shift(size)-p.minShift, 0)
+}
+
+func (p *BufferPool) Get(size int) *[]byte {
+	c := p.class(size)
+	if c >= len(p.classes) {
+		p.oversized.Add(1)
+		buf := make([]byte, size)
+		return &buf
+	}
+
+	if v := p.classes[c].Get(); v != nil {
+		p.hits.Add(1)
+		buf := v.(*[]byte)
+		*buf = (*buf)[:size]
+		return buf
+	}
+
+	p.misses.Add(1)
+	buf := make([]byte, size, 1<<(c+p.minShift))
+	return &buf
+}
+
+// Put returns a buffer to its size class; buffers that did not come from the pool, including oversized ones, are rejected so that a single huge buffer cannot be pinned in memory
+func (p *BufferPool) Put(buf *[]byte) error {
+	n := cap(*buf)
+	c := p.class(n)
+
+	switch {
+	case c >= len(p.classes):
+		p.rejected.Add(1)
+		return ErrOversized
+	case n != 1<<(c+p.minShift):
+		p.rejected.Add(1)
+		return ErrNotPoolable
+	}
+
+	*buf = (*buf)[:0]
+	p.classes[c].Put(buf)
+	return nil
+}
+
+func (p *BufferPool) Stats() Stats {
+	s := Stats{
+		Hits:      p.hits.Load(),
+		Misses:    p.misses.Load(),
+		Oversized: p.oversized.Load(),
+		Rejected:  p.rejected.Load(),
+	}
+	s.Allocs = s.Misses + s.Oversized
+	return s
+}
+
+const N = 1024 * 1024
+
+func main() {
+	pool := NewBufferPool(512, 64*1024)
+
+	// seed the pool with 4KB
+	seed := make([]*[]byte, 4)
+	for i := range seed {
+		seed[i] = pool.Get(1024)
+	}
+	for _, buf := range seed {
+		pool.Put(buf)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(N)
+
+	for i := 0; i < N; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			// mix in a few other sizes, all served from their own size class
+			size := 1024
+			switch i % 16 {
+			case 0:
+				size = 3000
+			case 1:
+				size = 100
+			}
+
+			buf := pool.Get(size)
+			defer pool.Put(buf)
+
+			// do something
+		}(i)
+	}
+
+	wg.Wait()
+
+	// an oversized buffer is allocated but never pooled
+	fmt.Println(pool.Put(pool.Get(1024 * 1024)))
+
+	fmt.Printf("%+v\n", pool.Stats())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBufferPoolSizeClasses(t *testing.T) {
+	pool := NewBufferPool(512, 4096)
+
+	for _, tt := range []struct {
+		size, cap int
+	}{
+		{0, 512},
+		{1, 512},
+		{512, 512},
+		{513, 1024},
+		{1024, 1024},
+		{4096, 4096},
+		{4097, 4097},
+	} {
+		buf := pool.Get(tt.size)
+		if len(*buf) != tt.size || cap(*buf) != tt.cap {
+			t.Errorf("Get(%d): len %d cap %d, want len %d cap %d", tt.size, len(*buf), cap(*buf), tt.size, tt.cap)
+		}
+	}
+}
+
+func TestBufferPoolPut(t *testing.T) {
+	pool := NewBufferPool(512, 4096)
+
+	if err := pool.Put(pool.Get(8192)); err != ErrOversized {
+		t.Fatalf("Put oversized = %v, want ErrOversized", err)
+	}
+
+	buf := make([]byte, 1000)
+	if err := pool.Put(&buf); err != ErrNotPoolable {
+		t.Fatalf("Put odd capacity = %v, want ErrNotPoolable", err)
+	}
+
+	if err := pool.Put(pool.Get(2000)); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+
+	s := pool.Stats()
+	if s.Rejected != 2 || s.Oversized != 1 || s.Misses != 1 || s.Allocs != 2 {
+		t.Fatalf("Stats = %+v", s)
+	}
+}
+
+// the counters must add up when hammered from many goroutines; run with -race
+func TestBufferPoolConcurrentStats(t *testing.T) {
+	pool := NewBufferPool(512, 4096)
+
+	const goroutines, gets = 64, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < gets; j++ {
+				buf := pool.Get(1024)
+				(*buf)[0] = byte(j)
+				pool.Put(buf)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := pool.Stats()
+	if s.Hits+s.Misses != goroutines*gets {
+		t.Fatalf("hits %d + misses %d != %d", s.Hits, s.Misses, goroutines*gets)
+	}
+}
+
+// sink keeps the compiler from allocating the buffers of BenchmarkMake on the stack, which would leave nothing for the pool to save
+var sink atomic.Pointer[byte]
+
+// the same load as the sync.Pool example: N goroutines that each need a 1KB buffer
+func BenchmarkMake(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		wg.Add(N)
+		for j := 0; j < N; j++ {
+			go func() {
+				defer wg.Done()
+				buf := make([]byte, 1024)
+				buf[0] = 1
+				sink.Store(&buf[0])
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	pool := NewBufferPool(512, 64*1024)
+
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		wg.Add(N)
+		for j := 0; j < N; j++ {
+			go func() {
+				defer wg.Done()
+				buf := pool.Get(1024)
+				(*buf)[0] = 1
+				pool.Put(buf)
+			}()
+		}
+		wg.Wait()
+	}
+
+	s := pool.Stats()
+	b.ReportMetric(float64(s.Allocs)/float64(b.N), "allocs/run")
+}
+
+// go test -bench=. -benchmem
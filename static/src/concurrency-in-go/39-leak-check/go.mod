@@ -0,0 +1,3 @@
+module m39
+
+go 1.22.5
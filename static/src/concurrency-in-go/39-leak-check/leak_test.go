@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	VerifyTestMain(m)
+}
+
+type recorder struct {
+	errs []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...any) {
+	r.errs = append(r.errs, fmt.Sprint(args...))
+}
+
+func TestVerifyNoneReportsLeak(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	r := &recorder{}
+	func() {
+		defer VerifyNone(r, IgnoreCurrent(), MaxRetries(3))
+
+		go func() { <-block }()
+	}()
+
+	if len(r.errs) != 1 || !strings.Contains(r.errs[0], "TestVerifyNoneReportsLeak.func") {
+		t.Fatalf("leak not reported: %q", r.errs)
+	}
+}
+
+func TestVerifyNoneWaitsForExit(t *testing.T) {
+	r := &recorder{}
+	func() {
+		defer VerifyNone(r, IgnoreCurrent())
+
+		// the goroutine is still running when the check starts but exits shortly after
+		done := make(chan struct{})
+		go func() { <-done }()
+		close(done)
+	}()
+
+	if len(r.errs) != 0 {
+		t.Fatalf("unexpected leak: %q", r.errs)
+	}
+}
+
+func TestIgnoreTopFunction(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	go blockedForever(block)
+
+	VerifyNone(t, IgnoreTopFunction("m39.blockedForever"))
+}
+
+func blockedForever(block <-chan struct{}) {
+	<-block
+}
+
+// each stage is abandoned before its input is drained; closing done must stop every goroutine of the stage
+
+func TestPipelineStagesDoNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	pipeline := multiply(done, add(done, multiply(done, generator(done, 1, 2, 3, 4), 2), 1), 2)
+	<-pipeline
+	close(done)
+}
+
+func TestGeneratorStagesDoNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	for range take(done, repeat(done, 1), 3) {
+	}
+	for range take(done, repeatFn(done, func() interface{} { return 1 }), 3) {
+	}
+	for range toString(done, take(done, repeat(done, "hello", "world"), 5)) {
+	}
+	close(done)
+}
+
+func TestFanInDoesNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	ins := make([]<-chan interface{}, 4)
+	for i := range ins {
+		ins[i] = repeat(done, i)
+	}
+	<-fanIn(done, ins...)
+	close(done)
+}
+
+func TestOrDoneDoesNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	<-orDone(done, repeat(done, 1))
+	close(done)
+}
+
+func TestTeeDoesNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	out1, out2 := tee(done, take(done, repeat(done, 1), 5))
+	<-out1
+	<-out2
+	close(done)
+}
+
+func TestBridgeDoesNotLeak(t *testing.T) {
+	defer VerifyNone(t, IgnoreCurrent())
+
+	done := make(chan interface{})
+	chans := make(chan (<-chan interface{}))
+	go func() {
+		defer close(chans)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case chans <- repeat(done, i):
+			}
+		}
+	}()
+
+	<-bridge(done, chans)
+	close(done)
+}
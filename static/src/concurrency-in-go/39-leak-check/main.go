@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the garbage collector does nothing to clean up goroutines that have been abandoned, so a leaked goroutine only shows up as slowly growing memory in production
+
+// a test can catch leaks by comparing the goroutines that exist once it has finished with those that existed when it started; anything new is a goroutine the test failed to stop
+
+// goroutines usually need a moment to exit after done is closed, so the check is retried with a growing delay before a goroutine is reported as leaked
+
+type goroutine struct {
+	id    int
+	top   string // function at the top of the stack
+	stack string
+}
+
+func (g goroutine) hasFunction(fn string) bool {
+	return strings.Contains(g.stack, "\n"+fn+"(")
+}
+
+// goroutines parses the output of runtime.Stack() for all goroutines except the calling one
+func goroutines() []goroutine {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var gs []goroutine
+	// the calling goroutine is always listed first
+	for _, stack := range strings.Split(string(buf), "\n\n")[1:] {
+		g, ok := parseGoroutine(stack)
+		if ok {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+// parseGoroutine parses a single stack of the form:
+//
+//	goroutine 7 [chan receive]:
+//	main.worker.func1()
+//		/path/main.go:12 +0x19
+//	created by main.worker in goroutine 1
+//		/path/main.go:10 +0x76
+func parseGoroutine(stack string) (goroutine, bool) {
+	header, rest, _ := strings.Cut(strings.TrimSpace(stack), "\n")
+
+	idAndState, ok := strings.CutPrefix(header, "goroutine ")
+	if !ok {
+		return goroutine{}, false
+	}
+	idStr, _, _ := strings.Cut(idAndState, " ")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return goroutine{}, false
+	}
+
+	top, _, _ := strings.Cut(rest, "\n")
+	if i := strings.LastIndexByte(top, '('); i > 0 {
+		top = top[:i]
+	}
+
+	return goroutine{id: id, top: top, stack: stack}, true
+}
+
+type options struct {
+	ignore     []func(goroutine) bool
+	maxRetries int
+}
+
+type Option func(*options)
+
+// IgnoreTopFunction ignores goroutines currently running or blocked in fn, e.g. "net/http.(*persistConn).readLoop"
+func IgnoreTopFunction(fn string) Option {
+	return func(o *options) {
+		o.ignore = append(o.ignore, func(g goroutine) bool { return g.top == fn })
+	}
+}
+
+// IgnoreAnyFunction ignores goroutines with fn anywhere on their stack
+func IgnoreAnyFunction(fn string) Option {
+	return func(o *options) {
+		o.ignore = append(o.ignore, func(g goroutine) bool { return g.hasFunction(fn) })
+	}
+}
+
+// IgnoreCurrent ignores every goroutine that exists at the time IgnoreCurrent is called; with defer the arguments are evaluated immediately, so `defer VerifyNone(t, IgnoreCurrent())` takes its snapshot at the start of the test
+func IgnoreCurrent() Option {
+	ids := make(map[int]bool)
+	for _, g := range goroutines() {
+		ids[g.id] = true
+	}
+	return func(o *options) {
+		o.ignore = append(o.ignore, func(g goroutine) bool { return ids[g.id] })
+	}
+}
+
+// MaxRetries sets how many times the check is repeated before goroutines are reported as leaked
+func MaxRetries(n int) Option {
+	return func(o *options) {
+		o.maxRetries = n
+	}
+}
+
+// goroutines that belong to the test runner or the runtime rather than the code under test
+var defaultIgnores = []Option{
+	IgnoreTopFunction("testing.RunTests"),
+	IgnoreTopFunction("testing.(*T).Run"),
+	IgnoreTopFunction("testing.(*T).Parallel"),
+	IgnoreTopFunction("testing.(*F).Fuzz"),
+	IgnoreTopFunction("testing.runFuzzing"),
+	IgnoreTopFunction("os/signal.signal_recv"),
+	IgnoreTopFunction("os/signal.loop"),
+	IgnoreAnyFunction("runtime.ensureSigM"),
+}
+
+func buildOptions(opts []Option) options {
+	o := options{maxRetries: 20}
+	for _, opt := range append(defaultIgnores, opts...) {
+		opt(&o)
+	}
+	return o
+}
+
+func (o options) leaked() []goroutine {
+	var leaked []goroutine
+next:
+	for _, g := range goroutines() {
+		for _, ignore := range o.ignore {
+			if ignore(g) {
+				continue next
+			}
+		}
+		leaked = append(leaked, g)
+	}
+	return leaked
+}
+
+// Find returns an error describing every unexpected goroutine that is still running after retrying
+func Find(opts ...Option) error {
+	o := buildOptions(opts)
+
+	delay := time.Microsecond
+	for i := 0; ; i++ {
+		leaked := o.leaked()
+		if len(leaked) == 0 {
+			return nil
+		}
+
+		if i == o.maxRetries {
+			var stacks []string
+			for _, g := range leaked {
+				stacks = append(stacks, g.stack)
+			}
+			return fmt.Errorf("found %d unexpected goroutines:\n\n%s", len(leaked), strings.Join(stacks, "\n\n"))
+		}
+
+		time.Sleep(delay)
+		delay = min(2*delay, 100*time.Millisecond)
+	}
+}
+
+// TB is the subset of testing.TB used to report leaks
+type TB interface {
+	Helper()
+	Error(args ...any)
+}
+
+// VerifyNone fails the test if unexpected goroutines are still running; call it as `defer VerifyNone(t, IgnoreCurrent())`
+func VerifyNone(t TB, opts ...Option) {
+	t.Helper()
+	if err := Find(opts...); err != nil {
+		t.Error(err)
+	}
+}
+
+// M is the subset of testing.M used by VerifyTestMain
+type M interface {
+	Run() int
+}
+
+// VerifyTestMain runs the tests and then fails the test binary if any goroutines were leaked by the package as a whole:
+//
+//	func TestMain(m *testing.M) {
+//		VerifyTestMain(m)
+//	}
+func VerifyTestMain(m M, opts ...Option) {
+	code := m.Run()
+	if code == 0 {
+		if err := Find(opts...); err != nil {
+			fmt.Fprintf(os.Stderr, "goroutine leak: %v\n", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+func main() {
+	worker := func(ch <-chan string) <-chan interface{} {
+		done := make(chan interface{})
+		go func() {
+			defer close(done)
+
+			for v := range ch {
+				fmt.Println(v)
+			}
+		}()
+
+		return done
+	}
+
+	before := IgnoreCurrent()
+
+	// goroutine will never exit and will leak
+	worker(nil)
+
+	fmt.Println(Find(before, MaxRetries(5)))
+}
@@ -0,0 +1,226 @@
+package main
+
+import "sync"
+
+// the pipeline stages below are copied from the pipeline examples so that each of them can be checked for leaks; the examples are main packages that cannot be imported, so TestStagesMatchExamples fails when a copy and its original drift apart
+
+// 23-pipelines
+
+func generator(done <-chan interface{}, integers ...int) <-chan int {
+	ch := make(chan int, len(integers))
+
+	go func() {
+		defer close(ch)
+		for _, v := range integers {
+			select {
+			case <-done:
+				return
+			case ch <- v:
+			}
+		}
+	}()
+	return ch
+}
+
+func multiply(done <-chan interface{}, in <-chan int, multiplier int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case <-done:
+				return
+			case out <- v * multiplier:
+			}
+		}
+	}()
+	return out
+}
+
+func add(done <-chan interface{}, in <-chan int, additive int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case <-done:
+				return
+			case out <- v * additive:
+			}
+		}
+	}()
+	return out
+}
+
+// 24-generators
+
+func repeat(done <-chan interface{}, values ...interface{}) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for {
+			for _, v := range values {
+				select {
+				case <-done:
+					return
+				case ch <- v:
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func take(done <-chan interface{}, in <-chan interface{}, n int) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			select {
+			case <-done:
+				return
+			case out <- <-in:
+			}
+		}
+	}()
+	return out
+}
+
+func repeatFn(done <-chan interface{}, fn func() interface{}) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-done:
+				return
+			case ch <- fn():
+			}
+		}
+	}()
+	return ch
+}
+
+func toString(done <-chan interface{}, in <-chan interface{}) <-chan string {
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case <-done:
+				return
+			case out <- v.(string):
+			}
+		}
+	}()
+	return out
+}
+
+// 25-fan-out-fan-in
+
+func fanIn(done <-chan interface{}, ins ...<-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+
+	for _, in := range ins {
+		go func() {
+			defer wg.Done()
+			for v := range in {
+				select {
+				case <-done:
+					return
+				case out <- v:
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// 26-or-done
+
+func orDone(done, in <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case out <- v:
+				case <-done:
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// 27-tee-channel
+
+func tee(done <-chan interface{}, in <-chan interface{}) (_, _ <-chan interface{}) {
+	out1, out2 := make(chan interface{}), make(chan interface{})
+
+	go func() {
+		defer close(out1)
+		defer close(out2)
+
+		for v := range orDone(done, in) {
+			var out1, out2 = out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+				case out1 <- v:
+					out1 = nil
+				case out2 <- v:
+					out2 = nil
+				}
+			}
+		}
+	}()
+
+	return out1, out2
+}
+
+// 28-bridge-channel
+
+func bridge(done <-chan interface{}, in <-chan <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for {
+			var ch <-chan interface{}
+			select {
+			case maybeCh, ok := <-in:
+				if !ok {
+					return
+				}
+				ch = maybeCh
+			case <-done:
+				return
+			}
+
+			for v := range orDone(done, ch) {
+				select {
+				case out <- v:
+				case <-done:
+				}
+			}
+		}
+	}()
+	return out
+}
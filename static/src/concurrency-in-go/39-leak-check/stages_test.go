@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+// stages.go copies the stages of the pipeline examples, which are main packages and cannot be imported; the copies must be kept in sync with the examples, otherwise the leak tests check code that no longer exists
+
+// funcs returns the source of the top level functions of the go files matching pattern, without their comments
+func funcs(t *testing.T, pattern string) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no files match %s: %v", pattern, err)
+	}
+
+	sources := make(map[string]string)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, fset, fn); err != nil {
+				t.Fatal(err)
+			}
+			sources[fn.Name.Name] = buf.String()
+		}
+	}
+	return sources
+}
+
+func TestStagesMatchExamples(t *testing.T) {
+	copies := funcs(t, "stages.go")
+
+	for example, names := range map[string][]string{
+		"23-pipelines":      {"generator", "multiply", "add"},
+		"24-generators":     {"repeat", "take", "repeatFn", "toString"},
+		"25-fan-out-fan-in": {"fanIn"},
+		"26-or-done":        {"orDone"},
+		"27-tee-channel":    {"tee"},
+		"28-bridge-channel": {"bridge"},
+	} {
+		originals := funcs(t, filepath.Join("..", example, "*.go"))
+		for _, name := range names {
+			original, ok := originals[name]
+			if !ok {
+				t.Errorf("%s no longer has %s", example, name)
+				continue
+			}
+			if copies[name] != original {
+				t.Errorf("%s in stages.go differs from %s:\n%s\nwant:\n%s", name, example, copies[name], original)
+			}
+		}
+	}
+}
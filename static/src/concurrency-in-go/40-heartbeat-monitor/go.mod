@@ -0,0 +1,3 @@
+module m40
+
+go 1.22.5
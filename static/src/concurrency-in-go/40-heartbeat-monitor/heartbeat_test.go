@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func identity(n int) int { return n }
+
+// the heartbeat tells the test when the goroutine has started working so there is no need to guess a sleep duration
+func TestDoWorkUnitGeneratesAllNumbers(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	intSlice := []int{0, 1, 2, 3, 5}
+	heartbeat, results := doWorkUnit(done, identity, intSlice...)
+
+	if err := awaitBeats(heartbeat, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range intSlice {
+		select {
+		case r := <-results:
+			if r != expected {
+				t.Errorf("index %v: expected %v, but received %v", i, expected, r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("test timed out")
+		}
+	}
+}
+
+// ticks are sent by hand so the interval worker is tested without waiting for a real ticker
+func TestDoWorkIntervalPulsesOnTicks(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	ticks := make(chan time.Time)
+	heartbeat, results := doWorkInterval(done, ticks, identity, 1, 2)
+
+	// nobody reads the results yet, so each tick turns into a pulse
+	for i := 0; i < 3; i++ {
+		ticks <- time.Time{}
+		if err := awaitBeats(heartbeat, 1, time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r := <-results; r != 1 {
+		t.Fatalf("expected 1, but received %v", r)
+	}
+	if r := <-results; r != 2 {
+		t.Fatalf("expected 2, but received %v", r)
+	}
+}
+
+func TestAwaitBeatsReportsClosedHeartbeat(t *testing.T) {
+	heartbeat := make(chan struct{})
+	close(heartbeat)
+
+	if err := awaitBeats(heartbeat, 1, time.Second); !errors.Is(err, ErrNoProgress) {
+		t.Fatalf("expected ErrNoProgress, but received %v", err)
+	}
+}
+
+func TestMonitorStatuses(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	heartbeat := make(chan struct{})
+	statuses := monitor(done, heartbeat, 20*time.Millisecond, 3)
+
+	expect := func(want Status) {
+		t.Helper()
+		select {
+		case s := <-statuses:
+			if s != want {
+				t.Fatalf("expected %v, but received %v", want, s)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %v", want)
+		}
+	}
+
+	expect(Late)
+	heartbeat <- struct{}{}
+	expect(Healthy)
+	expect(Late)
+	expect(Dead)
+
+	if _, ok := <-statuses; ok {
+		t.Fatal("expected statuses to be closed after Dead")
+	}
+}
+
+func TestMonitorClosedHeartbeatIsDead(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	heartbeat := make(chan struct{})
+	statuses := monitor(done, heartbeat, time.Hour, 3)
+	close(heartbeat)
+
+	if s := <-statuses; s != Dead {
+		t.Fatalf("expected dead, but received %v", s)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// heartbeats can either occur on a time interval or at the beginning of a unit of work
+
+// interval heartbeats are useful for concurrent code that might be waiting for something else to happen before it can process a unit of work; work-unit heartbeats are useful for tests since they tell the test exactly when the goroutine has started working
+
+// a heartbeat channel is buffered with a capacity of one so that at least one pulse is always sent out even if no one is listening in time, and pulses are never allowed to block the worker
+
+func newHeartbeat() chan struct{} {
+	return make(chan struct{}, 1)
+}
+
+func pulse(heartbeat chan<- struct{}) {
+	select {
+	case heartbeat <- struct{}{}:
+	// there may be no one listening to the heartbeat
+	default:
+	}
+}
+
+// doWorkInterval pulses on every tick and sends a result for each value; ticks is usually time.NewTicker(interval).C but tests can drive it by hand
+func doWorkInterval(done <-chan interface{}, ticks <-chan time.Time, work func(int) int, nums ...int) (<-chan struct{}, <-chan int) {
+	heartbeat := newHeartbeat()
+	results := make(chan int)
+
+	go func() {
+		defer close(heartbeat)
+		defer close(results)
+
+		for _, n := range nums {
+			r := work(n)
+			for sent := false; !sent; {
+				select {
+				case <-done:
+					return
+				case <-ticks:
+					pulse(heartbeat)
+				case results <- r:
+					sent = true
+				}
+			}
+		}
+	}()
+
+	return heartbeat, results
+}
+
+// doWorkUnit pulses at the beginning of each unit of work
+func doWorkUnit(done <-chan interface{}, work func(int) int, nums ...int) (<-chan struct{}, <-chan int) {
+	heartbeat := newHeartbeat()
+	results := make(chan int)
+
+	go func() {
+		defer close(heartbeat)
+		defer close(results)
+
+		for _, n := range nums {
+			pulse(heartbeat)
+
+			select {
+			case <-done:
+				return
+			case results <- work(n):
+			}
+		}
+	}()
+
+	return heartbeat, results
+}
+
+type Status int
+
+const (
+	Healthy Status = iota
+	Late           // missed at least one heartbeat
+	Dead           // missed too many heartbeats or stopped beating altogether
+)
+
+func (s Status) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Late:
+		return "late"
+	case Dead:
+		return "dead"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// monitor watches a heartbeat and reports every change in status; a worker is late once no pulse arrived within timeout and dead after maxMissed consecutive timeouts or when its heartbeat channel is closed
+
+// the status channel is closed after reporting Dead or when done is closed
+func monitor(done <-chan interface{}, heartbeat <-chan struct{}, timeout time.Duration, maxMissed int) <-chan Status {
+	statuses := make(chan Status)
+
+	go func() {
+		defer close(statuses)
+
+		current := Healthy
+		report := func(s Status) bool {
+			if s == current {
+				return true
+			}
+			current = s
+			select {
+			case <-done:
+				return false
+			case statuses <- s:
+				return true
+			}
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		missed := 0
+		for {
+			select {
+			case <-done:
+				return
+			case _, ok := <-heartbeat:
+				if !ok {
+					report(Dead)
+					return
+				}
+				missed = 0
+				if !report(Healthy) {
+					return
+				}
+			case <-timer.C:
+				missed++
+				if missed >= maxMissed {
+					report(Dead)
+					return
+				}
+				if !report(Late) {
+					return
+				}
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(timeout)
+		}
+	}()
+
+	return statuses
+}
+
+var ErrNoProgress = errors.New("no progress")
+
+// awaitBeats blocks until n heartbeats have been received; tests use it to know the worker has made progress instead of sleeping for a guessed duration, with timeout only as a guard against a worker that has hung
+func awaitBeats(heartbeat <-chan struct{}, n int, timeout time.Duration) error {
+	guard := time.After(timeout)
+	for i := 0; i < n; i++ {
+		select {
+		case _, ok := <-heartbeat:
+			if !ok {
+				return fmt.Errorf("%w: heartbeat closed after %d of %d beats", ErrNoProgress, i, n)
+			}
+		case <-guard:
+			return fmt.Errorf("%w: %d of %d beats within %v", ErrNoProgress, i, n, timeout)
+		}
+	}
+	return nil
+}
+
+func main() {
+	done := make(chan interface{})
+	defer close(done)
+
+	square := func(n int) int {
+		return n * n
+	}
+
+	// each result is preceded by a pulse
+	heartbeat, results := doWorkUnit(done, square, 1, 2, 3)
+	for r := range results {
+		<-heartbeat
+		fmt.Println("pulse", r)
+	}
+
+	// a worker that slows down is reported as late and then dead
+	const timeout = 100 * time.Millisecond
+	slow := func(n int) int {
+		time.Sleep(time.Duration(n) * timeout)
+		return n
+	}
+
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	heartbeat, results = doWorkInterval(done, ticker.C, slow, 0, 1, 5)
+	go func() {
+		for range results {
+		}
+	}()
+
+	for s := range monitor(done, heartbeat, timeout, 3) {
+		fmt.Println(s)
+	}
+}
@@ -0,0 +1,3 @@
+module m41
+
+go 1.22.5
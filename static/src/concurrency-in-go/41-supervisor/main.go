@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// in long-running processes it is useful to have a mechanism for ensuring goroutines remain healthy and restarting them if they become unhealthy
+
+// a supervisor (or steward) is responsible for starting the goroutines it watches over (its wards), monitoring their heartbeats and restarting them if they miss a deadline
+
+// with one-for-one only the unhealthy ward is restarted; with one-for-all every ward is restarted, which is useful when wards depend on each other
+
+// if wards keep failing then restarting them does not help; once more than maxRestarts restarts happen within the intensity window the supervisor stops its wards and itself, and since a supervisor has the same signature as a ward its own supervisor notices the missing heartbeat and restarts it, so failures escalate up the supervision tree
+
+type startGoroutineFn func(done <-chan interface{}, pulseInterval time.Duration) (heartbeat <-chan interface{})
+
+type Strategy int
+
+const (
+	OneForOne Strategy = iota
+	OneForAll
+)
+
+type SupervisorConfig struct {
+	Name        string
+	Strategy    Strategy
+	Timeout     time.Duration // a ward that has not pulsed for this long is restarted; one second if zero
+	MaxRestarts int
+	Within      time.Duration // window over which restarts are counted; five timeouts if zero
+}
+
+var logger = log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds)
+
+func pulse(heartbeat chan<- interface{}) {
+	select {
+	case heartbeat <- struct{}{}:
+	default:
+	}
+}
+
+type ward struct {
+	start     startGoroutineFn
+	done      chan interface{}
+	gen       int
+	lastPulse time.Time
+}
+
+type beat struct {
+	ward, gen int
+	exited    bool // the ward closed its heartbeat
+}
+
+func newSupervisor(cfg SupervisorConfig, starts ...startGoroutineFn) startGoroutineFn {
+	// wards pulse at half the timeout and are checked at a quarter of it, so it must be long enough to divide
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	cfg.Timeout = max(cfg.Timeout, 4*time.Nanosecond)
+	cfg.MaxRestarts = max(cfg.MaxRestarts, 0)
+	if cfg.Within <= 0 {
+		cfg.Within = 5 * cfg.Timeout
+	}
+
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+
+		go func() {
+			defer close(heartbeat)
+
+			wards := make([]*ward, len(starts))
+			beats := make(chan beat)
+
+			startWard := func(i int) {
+				w := wards[i]
+				w.done = make(chan interface{})
+				w.gen++
+				w.lastPulse = time.Now()
+
+				// forward the ward's pulses tagged with its generation so that beats from a replaced ward are ignored
+				wardHeartbeat := w.start(w.done, cfg.Timeout/2)
+				go func(done <-chan interface{}, gen int) {
+					for {
+						b := beat{ward: i, gen: gen}
+						select {
+						case <-done:
+							return
+						case _, ok := <-wardHeartbeat:
+							b.exited = !ok
+						}
+
+						select {
+						case <-done:
+							return
+						case beats <- b:
+						}
+						if b.exited {
+							return
+						}
+					}
+				}(w.done, w.gen)
+			}
+
+			stopWard := func(i int) {
+				close(wards[i].done)
+			}
+
+			for i, start := range starts {
+				wards[i] = &ward{start: start}
+				startWard(i)
+			}
+			logger.Printf("%s: started %d wards", cfg.Name, len(wards))
+
+			defer func() {
+				for i := range wards {
+					stopWard(i)
+				}
+			}()
+
+			var restarts []time.Time
+			restart := func(i int, reason string) bool {
+				now := time.Now()
+				for len(restarts) > 0 && now.Sub(restarts[0]) > cfg.Within {
+					restarts = restarts[1:]
+				}
+				restarts = append(restarts, now)
+				if len(restarts) > cfg.MaxRestarts {
+					logger.Printf("%s: ward %d %s; restart intensity exceeded, giving up", cfg.Name, i, reason)
+					return false
+				}
+
+				switch cfg.Strategy {
+				case OneForOne:
+					logger.Printf("%s: ward %d %s; restarting it", cfg.Name, i, reason)
+					stopWard(i)
+					startWard(i)
+				case OneForAll:
+					logger.Printf("%s: ward %d %s; restarting all wards", cfg.Name, i, reason)
+					for j := range wards {
+						stopWard(j)
+						startWard(j)
+					}
+				}
+				return true
+			}
+
+			pulseTicker := time.NewTicker(pulseInterval)
+			defer pulseTicker.Stop()
+
+			checkTicker := time.NewTicker(cfg.Timeout / 4)
+			defer checkTicker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulseTicker.C:
+					pulse(heartbeat)
+				case b := <-beats:
+					w := wards[b.ward]
+					if b.gen != w.gen {
+						continue
+					}
+					if b.exited {
+						if !restart(b.ward, "exited") {
+							return
+						}
+						continue
+					}
+					w.lastPulse = time.Now()
+				case now := <-checkTicker.C:
+					for i, w := range wards {
+						if now.Sub(w.lastPulse) > cfg.Timeout {
+							if !restart(i, "is unhealthy") {
+								return
+							}
+							break // a one-for-all restart has reset every ward
+						}
+					}
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+// newWorker starts a ward that pulses while it works but stops pulsing after hangAfter, simulating a goroutine stuck on something
+func newWorker(name string, hangAfter time.Duration) startGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+
+		go func() {
+			defer close(heartbeat)
+
+			pulseTicker := time.NewTicker(pulseInterval)
+			defer pulseTicker.Stop()
+
+			var hang <-chan time.Time
+			if hangAfter > 0 {
+				hang = time.After(hangAfter)
+			}
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulseTicker.C:
+					pulse(heartbeat)
+				case <-hang:
+					logger.Printf("%s: hanging", name)
+					<-done
+					return
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+func main() {
+	done := make(chan interface{})
+	time.AfterFunc(3*time.Second, func() { close(done) })
+
+	// the two workers depend on each other so they are always restarted together; one of them hangs so quickly that the inner supervisor gives up and is restarted by the root
+	inner := newSupervisor(SupervisorConfig{
+		Name:        "inner",
+		Strategy:    OneForAll,
+		Timeout:     200 * time.Millisecond,
+		MaxRestarts: 2,
+		Within:      time.Second,
+	},
+		newWorker("producer", 0),
+		newWorker("consumer", 100*time.Millisecond),
+	)
+
+	root := newSupervisor(SupervisorConfig{
+		Name:        "root",
+		Strategy:    OneForOne,
+		Timeout:     500 * time.Millisecond,
+		MaxRestarts: 5,
+		Within:      5 * time.Second,
+	},
+		inner,
+		newWorker("reporter", time.Second),
+	)
+
+	heartbeat := root(done, time.Second)
+	for range heartbeat {
+		fmt.Println("root is healthy")
+	}
+	fmt.Println("done")
+}
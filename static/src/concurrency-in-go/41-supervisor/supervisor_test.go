@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	logger.SetOutput(io.Discard)
+}
+
+// counted starts a ward that counts its starts and pulses only if healthy returns true for the start, counting from 1; otherwise it hangs
+func counted(starts *atomic.Int64, healthy func(n int64) bool) startGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+		ok := healthy(starts.Add(1))
+
+		go func() {
+			defer close(heartbeat)
+			if !ok {
+				<-done
+				return
+			}
+
+			pulseTicker := time.NewTicker(pulseInterval)
+			defer pulseTicker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulseTicker.C:
+					pulse(heartbeat)
+				}
+			}
+		}()
+		return heartbeat
+	}
+}
+
+func firstHangs(n int64) bool { return n > 1 }
+func always(n int64) bool     { return true }
+
+// eventually waits until cond holds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func config(strategy Strategy) SupervisorConfig {
+	return SupervisorConfig{Name: "test", Strategy: strategy, Timeout: 100 * time.Millisecond, MaxRestarts: 5, Within: time.Minute}
+}
+
+func TestOneForOne(t *testing.T) {
+	var hanging, healthy atomic.Int64
+	supervisor := newSupervisor(config(OneForOne), counted(&hanging, firstHangs), counted(&healthy, always))
+
+	done := make(chan interface{})
+	defer close(done)
+	supervisor(done, time.Second)
+
+	eventually(t, "the hanging ward was not restarted", func() bool { return hanging.Load() == 2 })
+	time.Sleep(200 * time.Millisecond)
+	if n := hanging.Load(); n != 2 {
+		t.Fatalf("restarted ward started %d times, want 2", n)
+	}
+	if n := healthy.Load(); n != 1 {
+		t.Fatalf("healthy ward started %d times, want 1", n)
+	}
+}
+
+func TestOneForAll(t *testing.T) {
+	var hanging, healthy atomic.Int64
+	supervisor := newSupervisor(config(OneForAll), counted(&hanging, firstHangs), counted(&healthy, always))
+
+	done := make(chan interface{})
+	defer close(done)
+	supervisor(done, time.Second)
+
+	eventually(t, "the wards were not restarted", func() bool { return hanging.Load() == 2 && healthy.Load() == 2 })
+	time.Sleep(200 * time.Millisecond)
+	if h, n := hanging.Load(), healthy.Load(); h != 2 || n != 2 {
+		t.Fatalf("wards started %d and %d times, want 2 each", h, n)
+	}
+}
+
+func TestExitedWardIsRestarted(t *testing.T) {
+	var starts atomic.Int64
+	exitsOnce := func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		if starts.Add(1) == 1 {
+			heartbeat := make(chan interface{})
+			close(heartbeat)
+			return heartbeat
+		}
+		return counted(new(atomic.Int64), always)(done, pulseInterval)
+	}
+	supervisor := newSupervisor(config(OneForOne), exitsOnce)
+
+	done := make(chan interface{})
+	defer close(done)
+	supervisor(done, time.Second)
+
+	eventually(t, "the exited ward was not restarted", func() bool { return starts.Load() == 2 })
+}
+
+func TestRestartIntensity(t *testing.T) {
+	var starts atomic.Int64
+	cfg := config(OneForOne)
+	cfg.MaxRestarts = 2
+	supervisor := newSupervisor(cfg, counted(&starts, func(int64) bool { return false }))
+
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := supervisor(done, time.Second)
+
+	// the supervisor gives up after two restarts and closes its heartbeat, so that its own supervisor notices
+	select {
+	case _, ok := <-heartbeat:
+		for ok {
+			_, ok = <-heartbeat
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("supervisor did not give up")
+	}
+	if n := starts.Load(); n != 3 {
+		t.Fatalf("ward started %d times, want 3", n)
+	}
+}
+
+func TestZeroConfig(t *testing.T) {
+	// a zero timeout used to panic when creating the check ticker
+	for _, timeout := range []time.Duration{0, 1} {
+		done := make(chan interface{})
+		newSupervisor(SupervisorConfig{Timeout: timeout}, counted(new(atomic.Int64), always))(done, time.Second)
+		close(done)
+	}
+}
@@ -0,0 +1,3 @@
+module m42
+
+go 1.22.5
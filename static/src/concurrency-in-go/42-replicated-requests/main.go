@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// for some applications receiving a response as quickly as possible is the top priority; in that case the request can be replicated to multiple handlers and the first one to respond wins
+
+// the or-channel only tells us that one of several signals fired; FirstOf also carries the result back, cancels the replicas that lost and, if every replica failed, reports all of their errors
+
+// the replicas should be given different runtime conditions (different processes, machines or paths to a data store) otherwise they are likely to be slow for the same reason
+
+type Result[T any] struct {
+	Value   T
+	Replica int           // index of the replica that won
+	Latency time.Duration // time until the winning response arrived
+}
+
+type ReplicaError struct {
+	Replica int
+	Err     error
+}
+
+func (e *ReplicaError) Error() string {
+	return fmt.Sprintf("replica %d: %v", e.Replica, e.Err)
+}
+
+func (e *ReplicaError) Unwrap() error {
+	return e.Err
+}
+
+// FirstOf calls fn once per replica concurrently and returns the first successful result; the context passed to the other replicas is cancelled as soon as there is a winner
+func FirstOf[T any](ctx context.Context, n int, fn func(ctx context.Context, replica int) (T, error)) (Result[T], error) {
+	if n <= 0 {
+		return Result[T]{}, errors.New("at least one replica is required")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type response struct {
+		value   T
+		replica int
+		err     error
+	}
+
+	// buffered so that losing replicas never block and leak after FirstOf has returned
+	responses := make(chan response, n)
+	start := time.Now()
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			v, err := fn(ctx, i)
+			responses <- response{value: v, replica: i, err: err}
+		}(i)
+	}
+
+	var errs []error
+	for i := 0; i < n; i++ {
+		select {
+		case r := <-responses:
+			if r.err == nil {
+				return Result[T]{Value: r.value, Replica: r.replica, Latency: time.Since(start)}, nil
+			}
+			errs = append(errs, &ReplicaError{Replica: r.replica, Err: r.err})
+		case <-ctx.Done():
+			return Result[T]{}, errors.Join(append(errs, ctx.Err())...)
+		}
+	}
+
+	return Result[T]{}, errors.Join(errs...)
+}
+
+// handler simulates a service whose latency has a long tail
+func handler(ctx context.Context, replica int) (string, error) {
+	latency := time.Duration(1+rand.Intn(5)) * time.Millisecond
+	if rand.Intn(10) == 0 {
+		latency *= 20
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(latency):
+	}
+
+	if rand.Intn(20) == 0 {
+		return "", errors.New("internal error")
+	}
+	return fmt.Sprintf("response from replica %d", replica), nil
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	slices.Sort(latencies)
+	return latencies[int(p*float64(len(latencies)-1))]
+}
+
+func main() {
+	ctx := context.Background()
+
+	r, err := FirstOf(ctx, 10, handler)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%s in %v\n", r.Value, r.Latency)
+
+	// compare the tail latency of a single request with that of replicated requests
+	const requests = 200
+	for _, replicas := range []int{1, 2, 3} {
+		var latencies []time.Duration
+		wins := make([]int, replicas)
+		failures := 0
+
+		for i := 0; i < requests; i++ {
+			r, err := FirstOf(ctx, replicas, handler)
+			if err != nil {
+				failures++
+				continue
+			}
+			latencies = append(latencies, r.Latency)
+			wins[r.Replica]++
+		}
+
+		fmt.Printf("replicas=%d p50=%v p99=%v failures=%d wins=%v\n",
+			replicas,
+			percentile(latencies, 0.50).Round(time.Millisecond),
+			percentile(latencies, 0.99).Round(time.Millisecond),
+			failures,
+			wins,
+		)
+	}
+
+	// when every replica fails the errors of all of them are returned
+	_, err = FirstOf(ctx, 3, func(ctx context.Context, replica int) (int, error) {
+		return 0, errors.New("unavailable")
+	})
+	fmt.Println(err)
+}
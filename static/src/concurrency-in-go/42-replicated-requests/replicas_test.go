@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFirstSuccessWins(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	cancelled := make(chan int, 2)
+
+	r, err := FirstOf(context.Background(), 3, func(ctx context.Context, replica int) (string, error) {
+		if replica == 1 {
+			return "fast", nil
+		}
+		// the losers block until they are cancelled
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			cancelled <- replica
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+			return "slow", nil
+		}
+	})
+	if err != nil || r.Value != "fast" || r.Replica != 1 {
+		t.Fatalf("got %+v, %v", r, err)
+	}
+
+	wg.Wait()
+	if len(cancelled) != 2 {
+		t.Fatalf("%d losers cancelled, want 2", len(cancelled))
+	}
+}
+
+func TestFailedReplicaDoesNotWin(t *testing.T) {
+	r, err := FirstOf(context.Background(), 2, func(ctx context.Context, replica int) (int, error) {
+		if replica == 0 {
+			return 0, errors.New("fast failure")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return 42, nil
+	})
+	if err != nil || r.Value != 42 || r.Replica != 1 {
+		t.Fatalf("got %+v, %v", r, err)
+	}
+}
+
+func TestAllReplicasFail(t *testing.T) {
+	_, err := FirstOf(context.Background(), 3, func(ctx context.Context, replica int) (int, error) {
+		return 0, fmt.Errorf("error %d", replica)
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the joined error holds a ReplicaError for every replica
+	seen := make(map[int]bool)
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var re *ReplicaError
+		if !errors.As(e, &re) || re.Err.Error() != fmt.Sprintf("error %d", re.Replica) {
+			t.Fatalf("unexpected error %v", e)
+		}
+		seen[re.Replica] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("errors of replicas %v, want all 3", seen)
+	}
+}
+
+func TestFirstOfContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := FirstOf(ctx, 2, func(ctx context.Context, replica int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v", err)
+	}
+
+	if _, err := FirstOf(context.Background(), 0, func(ctx context.Context, replica int) (int, error) { return 0, nil }); err == nil {
+		t.Fatal("expected an error for no replicas")
+	}
+}
@@ -0,0 +1,3 @@
+module m43
+
+go 1.22.5
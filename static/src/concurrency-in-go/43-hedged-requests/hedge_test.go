@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newServer responds immediately unless slow returns true for the n-th request (counting from 1); cancelled requests are counted
+func newServer(t *testing.T, slow func(n int64) bool) (*httptest.Server, *atomic.Int64) {
+	var requests, cancelled atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow(requests.Add(1)) {
+			select {
+			case <-r.Context().Done():
+				cancelled.Add(1)
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	t.Cleanup(server.Close)
+	return server, &cancelled
+}
+
+func get(t *testing.T, client *http.Client, url string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if body, _ := io.ReadAll(response.Body); string(body) != "ok" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	return time.Since(start)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func ok(req *http.Request) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok")), Request: req}
+}
+
+// seed records n samples of latency d for url
+func seed(transport *HedgedTransport, url string, n int, d time.Duration) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for range n {
+		transport.observe(endpoint(req), d)
+	}
+}
+
+func TestNoHedgeWhenFast(t *testing.T) {
+	// the transport answers at once, far sooner than the p95 of the seeded samples, so no scheduling hiccup can trigger a hedge
+	transport := NewHedgedTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return ok(req), nil
+	}), 1)
+	client := &http.Client{Transport: transport}
+
+	const url = "http://example.com/"
+	seed(transport, url, window/2, time.Second)
+	for i := 0; i < window/2-5; i++ {
+		get(t, client, url)
+	}
+
+	if s := transport.Stats(); s.HedgesSent != 0 {
+		t.Fatalf("expected no hedges, got %+v", s)
+	}
+}
+
+func TestLoserLatencyIsObserved(t *testing.T) {
+	var requests atomic.Int64
+	transport := NewHedgedTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// the primary hangs until it is cancelled, the hedge answers at once
+		if requests.Add(1) == 1 {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return ok(req), nil
+	}), 1)
+	client := &http.Client{Transport: transport}
+
+	const url = "http://example.com/"
+	const delay = 20 * time.Millisecond
+	seed(transport, url, minSamples, delay)
+	get(t, client, url)
+
+	if s := transport.Stats(); s.HedgesWon != 1 {
+		t.Fatalf("expected the hedge to win, got %+v", s)
+	}
+
+	// the winner and the cancelled primary are both recorded, the primary no faster than the hedge delay
+	deadline := time.Now().Add(time.Second)
+	for {
+		transport.mu.Lock()
+		samples := slices.Clone(transport.endpoints["GET "+url].samples)
+		transport.mu.Unlock()
+
+		if len(samples) == minSamples+2 {
+			if slowest := slices.Max(samples); slowest <= delay {
+				t.Fatalf("primary recorded as %v, want more than %v", slowest, delay)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d samples recorded, want %d", len(samples), minSamples+2)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgeWinsAndCancelsLoser(t *testing.T) {
+	const slowRequest = minSamples + 1
+	server, cancelled := newServer(t, func(n int64) bool { return n == slowRequest })
+	transport := NewHedgedTransport(nil, 1)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < minSamples; i++ {
+		get(t, client, server.URL)
+	}
+
+	if d := get(t, client, server.URL); d > 250*time.Millisecond {
+		t.Fatalf("hedged request took %v", d)
+	}
+
+	s := transport.Stats()
+	if s.HedgesSent != 1 || s.HedgesWon != 1 {
+		t.Fatalf("expected one hedge sent and won, got %+v", s)
+	}
+
+	// the slow primary is cancelled once the hedge has won
+	deadline := time.Now().Add(time.Second)
+	for cancelled.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("losing request was not cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHedgeBudget(t *testing.T) {
+	// every other request is slow once warmed up, far more than the budget allows hedging
+	server, _ := newServer(t, func(n int64) bool { return n > minSamples && n%2 == 1 })
+	transport := NewHedgedTransport(nil, 0.1)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < minSamples; i++ {
+		get(t, client, server.URL)
+	}
+
+	for i := 0; i < 10; i++ {
+		get(t, client, server.URL)
+	}
+
+	s := transport.Stats()
+	if float64(s.HedgesSent) > 0.1*float64(s.Requests) {
+		t.Fatalf("hedges exceeded budget: %+v", s)
+	}
+	if s.HedgesSent == 0 {
+		t.Fatalf("expected some hedges: %+v", s)
+	}
+}
+
+func TestFailedHedgeIsRefunded(t *testing.T) {
+	transport := NewHedgedTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(20 * time.Millisecond)
+		return ok(req), nil
+	}), 1)
+	seed(transport, "http://example.com/", minSamples, time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", strings.NewReader("query"))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return nil, errors.New("body cannot be replayed")
+	}
+	response, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if s := transport.Stats(); s.HedgesSent != 0 {
+		t.Fatalf("a hedge that was never sent counts against the budget: %+v", s)
+	}
+}
+
+func TestNonIdempotentRequestsAreNotHedged(t *testing.T) {
+	server, _ := newServer(t, func(n int64) bool { return false })
+	transport := NewHedgedTransport(nil, 1)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 2*minSamples; i++ {
+		response, err := client.Post(server.URL, "text/plain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+
+	if s := transport.Stats(); s.HedgesSent != 0 {
+		t.Fatalf("expected no hedges, got %+v", s)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicating every request doubles the load on the upstream; a hedged request is only sent once the first one has taken longer than most requests to that endpoint usually take
+
+// the delay is the running p95 latency of the endpoint, so roughly one request in twenty is hedged, and the total number of hedges is capped at a percentage of all requests so that a slow upstream is not pushed over the edge by the extra load
+
+// whichever attempt answers first wins and the other one is cancelled
+
+const (
+	window     = 100 // latency samples kept per endpoint
+	minSamples = 20  // no hedging until an endpoint has this many samples
+)
+
+type latencies struct {
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencies) add(d time.Duration) {
+	if len(l.samples) < window {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % window
+}
+
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	if len(l.samples) < minSamples {
+		return 0, false
+	}
+	sorted := slices.Clone(l.samples)
+	slices.Sort(sorted)
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+type Stats struct {
+	Requests   int64
+	HedgesSent int64
+	HedgesWon  int64
+}
+
+// HedgedTransport is an http.RoundTripper that hedges idempotent requests
+type HedgedTransport struct {
+	Transport http.RoundTripper
+	Budget    float64 // maximum hedges as a fraction of requests, e.g. 0.05
+
+	mu        sync.Mutex
+	endpoints map[string]*latencies
+
+	requests, hedgesSent, hedgesWon atomic.Int64
+}
+
+func NewHedgedTransport(transport http.RoundTripper, budget float64) *HedgedTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &HedgedTransport{
+		Transport: transport,
+		Budget:    budget,
+		endpoints: make(map[string]*latencies),
+	}
+}
+
+func endpoint(req *http.Request) string {
+	return req.Method + " " + req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+}
+
+func (t *HedgedTransport) hedgeDelay(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok := t.endpoints[key]; ok {
+		return l.percentile(0.95)
+	}
+	return 0, false
+}
+
+func (t *HedgedTransport) observe(key string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.endpoints[key]
+	if !ok {
+		l = &latencies{}
+		t.endpoints[key] = l
+	}
+	l.add(d)
+}
+
+// reserveHedge takes a hedge out of the budget if there is one left
+func (t *HedgedTransport) reserveHedge() bool {
+	for {
+		sent := t.hedgesSent.Load()
+		if float64(sent+1) > t.Budget*float64(t.requests.Load()) {
+			return false
+		}
+		if t.hedgesSent.CompareAndSwap(sent, sent+1) {
+			return true
+		}
+	}
+}
+
+func (t *HedgedTransport) Stats() Stats {
+	return Stats{
+		Requests:   t.requests.Load(),
+		HedgesSent: t.hedgesSent.Load(),
+		HedgesWon:  t.hedgesWon.Load(),
+	}
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+// cancelOnClose releases the context of the winning attempt once its body has been consumed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type attempt struct {
+	id       int
+	hedge    bool
+	response *http.Response
+	err      error
+	latency  time.Duration
+	cancel   context.CancelFunc
+}
+
+func (t *HedgedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+
+	key := endpoint(req)
+	delay, ok := t.hedgeDelay(key)
+	if !ok || !idempotent(req) {
+		start := time.Now()
+		response, err := t.Transport.RoundTrip(req)
+		if err == nil {
+			t.observe(key, time.Since(start))
+		}
+		return response, err
+	}
+
+	attempts := make(chan attempt, 2)
+	var cancels []context.CancelFunc
+	send := func(hedge bool) error {
+		ctx, cancel := context.WithCancel(req.Context())
+		r := req.Clone(ctx)
+		if hedge && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return err
+			}
+			r.Body = body
+		}
+
+		id := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			start := time.Now()
+			response, err := t.Transport.RoundTrip(r)
+			attempts <- attempt{id: id, hedge: hedge, response: response, err: err, latency: time.Since(start), cancel: cancel}
+		}()
+		return nil
+	}
+
+	send(false)
+	inFlight := 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if t.reserveHedge() {
+				if send(true) == nil {
+					inFlight++
+				} else {
+					// the hedge was never sent, so give it back to the budget
+					t.hedgesSent.Add(-1)
+				}
+			}
+		case a := <-attempts:
+			inFlight--
+			if a.err != nil {
+				a.cancel()
+				lastErr = a.err
+				continue
+			}
+
+			// cancel the loser and drain its response in the background
+			for id, cancel := range cancels {
+				if id != a.id {
+					cancel()
+				}
+			}
+			if inFlight > 0 {
+				go func() {
+					loser := <-attempts
+					if loser.err == nil {
+						loser.response.Body.Close()
+					}
+					// a primary that lost took at least as long as it ran before being cancelled; leaving it out would only keep the fast requests and drag the p95 down, hedging ever more requests
+					if loser.err == nil || !loser.hedge {
+						t.observe(key, loser.latency)
+					}
+				}()
+			}
+
+			if a.hedge {
+				t.hedgesWon.Add(1)
+			}
+			t.observe(key, a.latency)
+			a.response.Body = &cancelOnClose{ReadCloser: a.response.Body, cancel: a.cancel}
+			return a.response, nil
+		}
+	}
+	return nil, lastErr
+}
+
+type Result struct {
+	Err      error
+	Response *http.Response
+}
+
+func fetchAll(done <-chan interface{}, client *http.Client, urls ...string) <-chan Result {
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		for _, url := range urls {
+			response, err := client.Get(url)
+			result := Result{Err: err, Response: response}
+			select {
+			case <-done:
+				return
+			case results <- result:
+			}
+		}
+	}()
+
+	return results
+}
+
+func main() {
+	// one response in twenty is very slow
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay := time.Duration(1+rand.Intn(4)) * time.Millisecond
+		if rand.Intn(20) == 0 {
+			delay = 200 * time.Millisecond
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer server.Close()
+
+	transport := NewHedgedTransport(nil, 0.1)
+	client := &http.Client{Transport: transport}
+
+	done := make(chan interface{})
+	defer close(done)
+
+	urls := make([]string, 500)
+	for i := range urls {
+		urls[i] = server.URL
+	}
+
+	var slowest time.Duration
+	start := time.Now()
+	for r := range fetchAll(done, client, urls...) {
+		if r.Err != nil {
+			fmt.Printf("error: %v\n", r.Err)
+			continue
+		}
+		io.Copy(io.Discard, r.Response.Body)
+		r.Response.Body.Close()
+
+		slowest = max(slowest, time.Since(start))
+		start = time.Now()
+	}
+
+	fmt.Printf("slowest response: %v\n", slowest.Round(time.Millisecond))
+	fmt.Printf("%+v\n", transport.Stats())
+}
@@ -0,0 +1,3 @@
+module m44
+
+go 1.22.5
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLimit(t *testing.T) {
+	const limit = 3
+	g := NewGroup(context.Background(), WithLimit(limit))
+
+	var running, peak atomic.Int64
+	for range 20 {
+		g.Go(func(ctx context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if p := peak.Load(); p != limit {
+		t.Fatalf("%d goroutines ran at once, want %d", p, limit)
+	}
+}
+
+func TestFirstErrorCancelsContext(t *testing.T) {
+	g := NewGroup(context.Background())
+	errFirst := errors.New("first")
+
+	g.Go(func(ctx context.Context) error {
+		return errFirst
+	})
+	var cause error
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			cause = context.Cause(ctx)
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("context was not cancelled")
+		}
+	})
+
+	if err := g.Wait(); err != errFirst {
+		t.Fatalf("got %v, want only the first error", err)
+	}
+	if cause != errFirst {
+		t.Fatalf("cancelled with cause %v, want the first error", cause)
+	}
+}
+
+func TestWithAllErrors(t *testing.T) {
+	g := NewGroup(context.Background(), WithAllErrors())
+	errA, errB := errors.New("a"), errors.New("b")
+
+	g.Go(func(ctx context.Context) error { return errA })
+	g.Go(func(ctx context.Context) error { return errB })
+	g.Go(func(ctx context.Context) error { return nil })
+
+	err := g.Wait()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("got %v, want both errors", err)
+	}
+}
+
+func TestPanicIsRaisedInWait(t *testing.T) {
+	g := NewGroup(context.Background())
+
+	g.Go(func(ctx context.Context) error {
+		panic("child is broken")
+	})
+	cancelled := false
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-time.After(time.Second):
+		}
+		return nil
+	})
+
+	defer func() {
+		p, ok := recover().(*PanicError)
+		if !ok || p.Value != "child is broken" || len(p.Stack) == 0 {
+			t.Fatalf("Wait panicked with %v", p)
+		}
+		if !cancelled {
+			t.Fatal("the panic did not cancel the other goroutines")
+		}
+	}()
+	g.Wait()
+	t.Fatal("Wait returned instead of panicking")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// wiring goroutines together by hand with a WaitGroup and a cancel function is easy to get wrong: an error has to be smuggled out of the goroutine, someone has to remember to call cancel() and a panic in a child takes down the whole process without the parent ever knowing
+
+// a Group ties the lifetime of its goroutines to a single call: Wait() does not return until every goroutine started with Go() has returned, the first error cancels the context shared by all of them and a panic in a child is re-raised in the goroutine calling Wait()
+
+type PanicError struct {
+	Value any
+	Stack []byte // stack of the goroutine that panicked, captured at the point of recovery
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\ngoroutine stack:\n%s", p.Value, p.Stack)
+}
+
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	wg  sync.WaitGroup
+	sem chan struct{}
+
+	mu       sync.Mutex
+	errs     []error
+	panicked *PanicError
+
+	allErrors bool
+}
+
+type Option func(*Group)
+
+// WithLimit limits the number of goroutines running at once; Go() blocks until a slot is free
+func WithLimit(n int) Option {
+	return func(g *Group) {
+		g.sem = make(chan struct{}, n)
+	}
+}
+
+// WithAllErrors makes Wait() return every error joined together rather than only the first one
+func WithAllErrors() Option {
+	return func(g *Group) {
+		g.allErrors = true
+	}
+}
+
+func NewGroup(ctx context.Context, opts ...Option) *Group {
+	ctx, cancel := context.WithCancelCause(ctx)
+	g := &Group{ctx: ctx, cancel: cancel}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.errs = append(g.errs, err)
+	if len(g.errs) == 1 {
+		g.cancel(err)
+	}
+}
+
+func (g *Group) Go(f func(ctx context.Context) error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				p := &PanicError{Value: r, Stack: debug.Stack()}
+				g.mu.Lock()
+				if g.panicked == nil {
+					g.panicked = p
+				}
+				g.mu.Unlock()
+				g.cancel(p)
+			}
+		}()
+
+		if err := f(g.ctx); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all goroutines have returned, then re-panics if any of them panicked and otherwise returns the first error (or all errors with WithAllErrors)
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(context.Canceled)
+
+	if g.panicked != nil {
+		panic(g.panicked)
+	}
+
+	switch {
+	case len(g.errs) == 0:
+		return nil
+	case g.allErrors:
+		return errors.Join(g.errs...)
+	default:
+		return g.errs[0]
+	}
+}
+
+func locale(ctx context.Context) (string, error) {
+	// fail fast if we will exceed the deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		if deadline.Sub(time.Now().Add(1*time.Minute)) <= 0 {
+			return "", context.DeadlineExceeded
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(1 * time.Minute):
+	}
+
+	return "EN/US", nil
+}
+
+func genGreeting(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	switch locale, err := locale(ctx); {
+	case err != nil:
+		return "", err
+	case locale == "EN/US":
+		return "hello", nil
+	}
+	return "", fmt.Errorf("unsupported locale")
+}
+
+func printGreeting(ctx context.Context) error {
+	greeting, err := genGreeting(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot print greeting: %w", err)
+	}
+	fmt.Printf("%s world!\n", greeting)
+	return nil
+}
+
+func genFarewell(ctx context.Context) (string, error) {
+	switch locale, err := locale(ctx); {
+	case err != nil:
+		return "", err
+	case locale == "EN/US":
+		return "goodbye", nil
+	}
+	return "", fmt.Errorf("unsupported locale")
+}
+
+func printFarewell(ctx context.Context) error {
+	farewell, err := genFarewell(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot print farewell: %w", err)
+	}
+	fmt.Printf("%s world!\n", farewell)
+	return nil
+}
+
+func main() {
+	// the greeting fails fast which cancels the farewell; there is no cancel() to remember
+	g := NewGroup(context.Background())
+	g.Go(printGreeting)
+	g.Go(printFarewell)
+	fmt.Println(g.Wait())
+
+	// every error can be collected instead
+	g = NewGroup(context.Background(), WithAllErrors())
+	g.Go(printGreeting)
+	g.Go(printFarewell)
+	fmt.Println(g.Wait())
+
+	// at most two of the five jobs run at a time
+	g = NewGroup(context.Background(), WithLimit(2))
+	var mu sync.Mutex
+	running, peak := 0, 0
+	for i := 0; i < 5; i++ {
+		g.Go(func(ctx context.Context) error {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+	}
+	fmt.Println(g.Wait(), "peak concurrency:", peak)
+
+	// a panic in a child is re-raised by Wait() in the parent, carrying the child's stack
+	defer func() {
+		if p, ok := recover().(*PanicError); ok {
+			fmt.Println("recovered:", p.Value)
+		}
+	}()
+
+	g = NewGroup(context.Background())
+	g.Go(func(ctx context.Context) error {
+		var m map[string]int
+		m["boom"]++
+		return nil
+	})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	})
+	g.Wait()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// noLeaks fails the test if more goroutines are running than before once fn returned
+func noLeaks(t *testing.T, fn func()) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	fn()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func cancelled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestAwaitCancelledDoesNotLeak(t *testing.T) {
+	f, resolve := NewPromise[int]()
+
+	noLeaks(t, func() {
+		for range 100 {
+			if _, err := f.Await(cancelled()); !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v", err)
+			}
+		}
+		// continuations of a future that is never resolved park no goroutines either
+		for range 100 {
+			Map(f, func(v int) int { return v })
+		}
+	})
+
+	// the future can still be resolved and awaited afterwards
+	resolve(42, nil)
+	if v, err := f.Await(context.Background()); v != 42 || err != nil {
+		t.Fatalf("got %v, %v", v, err)
+	}
+}
+
+func TestThen(t *testing.T) {
+	ctx := context.Background()
+
+	n := Then(Resolved(2), func(v int) (string, error) {
+		return strings.Repeat("a", v), nil
+	})
+	if v, err := n.Await(ctx); v != "aa" || err != nil {
+		t.Fatalf("got %q, %v", v, err)
+	}
+
+	// an error is passed through without calling fn
+	failed, resolve := NewPromise[int]()
+	resolve(0, errors.New("failed"))
+	called := false
+	_, err := Then(failed, func(v int) (int, error) {
+		called = true
+		return v, nil
+	}).Await(ctx)
+	if err == nil || called {
+		t.Fatalf("got %v, fn called %v", err, called)
+	}
+}
+
+func TestThenPanic(t *testing.T) {
+	f, resolve := NewPromise[int]()
+	next := Then(f, func(v int) (int, error) {
+		panic("continuation is broken")
+	})
+	resolve(1, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := next.Await(ctx); err == nil || !strings.Contains(err.Error(), "continuation is broken") {
+		t.Fatalf("got %v, want the panic as an error", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	ctx := context.Background()
+
+	a, resolveA := NewPromise[int]()
+	b, resolveB := NewPromise[int]()
+	all := All(a, b)
+	resolveB(2, nil)
+	resolveA(1, nil)
+	if v, err := all.Await(ctx); err != nil || len(v) != 2 || v[0] != 1 || v[1] != 2 {
+		t.Fatalf("got %v, %v", v, err)
+	}
+
+	// the first error resolves All without waiting for the rest
+	pending, _ := NewPromise[int]()
+	failed, resolve := NewPromise[int]()
+	all = All(pending, failed)
+	resolve(0, errors.New("down"))
+	timeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := all.Await(timeout); err == nil || err.Error() != "down" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestAny(t *testing.T) {
+	ctx := context.Background()
+
+	// the first success wins without waiting for the rest
+	pending, _ := NewPromise[int]()
+	ok, resolve := NewPromise[int]()
+	first := Any(pending, ok)
+	resolve(5, nil)
+	timeout, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if v, err := first.Await(timeout); v != 5 || err != nil {
+		t.Fatalf("got %v, %v", v, err)
+	}
+
+	a, resolveA := NewPromise[int]()
+	b, resolveB := NewPromise[int]()
+	errA, errB := errors.New("a"), errors.New("b")
+	first = Any(a, b)
+	resolveA(0, errA)
+	resolveB(0, errB)
+	if _, err := first.Await(ctx); !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("got %v, want both errors", err)
+	}
+}
+
+func TestAllAnyCancelled(t *testing.T) {
+	// awaiting a combination of futures that never resolve can be given up on without leaking
+	noLeaks(t, func() {
+		var fs []*Future[int]
+		for range 10 {
+			f, _ := NewPromise[int]()
+			fs = append(fs, f)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := All(fs...).Await(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("All: got %v", err)
+		}
+		if _, err := Any(fs...).Await(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Any: got %v", err)
+		}
+	})
+}
@@ -0,0 +1,3 @@
+module m45
+
+go 1.22.5
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// a single-use channel such as completed or results works as an asynchronous result but it can only be received once, carries no error and leaks its sender if no one ever receives
+
+// a Future holds the result instead of sending it: the producer stores the value and closes done, so any number of goroutines can Await() it, the producer never blocks and an Await() that gives up because its context was cancelled leaves nothing behind
+
+// chaining with Then() and Map() registers a callback rather than parking a goroutine on the future, so a future that is never resolved does not leak its continuations either
+
+type Future[T any] struct {
+	done chan struct{}
+
+	mu        sync.Mutex
+	resolved  bool
+	value     T
+	err       error
+	callbacks []func()
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// NewPromise returns an unresolved future along with the function that resolves it; only the first call to resolve has any effect
+func NewPromise[T any]() (*Future[T], func(T, error) bool) {
+	f := newFuture[T]()
+	return f, f.resolve
+}
+
+func (f *Future[T]) resolve(v T, err error) bool {
+	f.mu.Lock()
+	if f.resolved {
+		f.mu.Unlock()
+		return false
+	}
+	f.resolved = true
+	f.value, f.err = v, err
+	callbacks := f.callbacks
+	f.callbacks = nil
+	close(f.done)
+	f.mu.Unlock()
+
+	for _, cb := range callbacks {
+		go cb()
+	}
+	return true
+}
+
+// onResolve runs cb once the future is resolved, immediately if it already is
+func (f *Future[T]) onResolve(cb func()) {
+	f.mu.Lock()
+	if !f.resolved {
+		f.callbacks = append(f.callbacks, cb)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	go cb()
+}
+
+// Async runs fn in a new goroutine and returns a future for its result; a panic in fn resolves the future with an error
+func Async[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := newFuture[T]()
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				f.resolve(zero, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		f.resolve(fn(ctx))
+	}()
+	return f
+}
+
+func Resolved[T any](v T) *Future[T] {
+	f := newFuture[T]()
+	f.resolve(v, nil)
+	return f
+}
+
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await blocks until the future is resolved or ctx is done
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Then calls fn with the value of f once it resolves successfully; an error from f is passed through without calling fn and, as with Async, a panic in fn resolves the future with an error
+func Then[T, U any](f *Future[T], fn func(T) (U, error)) *Future[U] {
+	next := newFuture[U]()
+	f.onResolve(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero U
+				next.resolve(zero, fmt.Errorf("panic: %v", r))
+			}
+		}()
+
+		if f.err != nil {
+			var zero U
+			next.resolve(zero, f.err)
+			return
+		}
+		next.resolve(fn(f.value))
+	})
+	return next
+}
+
+func Map[T, U any](f *Future[T], fn func(T) U) *Future[U] {
+	return Then(f, func(v T) (U, error) {
+		return fn(v), nil
+	})
+}
+
+// All resolves with every value in order once all futures succeed, or with the first error
+func All[T any](fs ...*Future[T]) *Future[[]T] {
+	all := newFuture[[]T]()
+	if len(fs) == 0 {
+		all.resolve(nil, nil)
+		return all
+	}
+
+	values := make([]T, len(fs))
+	var mu sync.Mutex
+	remaining := len(fs)
+
+	for i, f := range fs {
+		f.onResolve(func() {
+			if f.err != nil {
+				all.resolve(nil, f.err)
+				return
+			}
+
+			mu.Lock()
+			values[i] = f.value
+			remaining--
+			last := remaining == 0
+			mu.Unlock()
+
+			if last {
+				all.resolve(values, nil)
+			}
+		})
+	}
+	return all
+}
+
+// Any resolves with the first successful value, or with all errors joined if every future fails
+func Any[T any](fs ...*Future[T]) *Future[T] {
+	first := newFuture[T]()
+	if len(fs) == 0 {
+		var zero T
+		first.resolve(zero, errors.New("no futures"))
+		return first
+	}
+
+	errs := make([]error, len(fs))
+	var mu sync.Mutex
+	remaining := len(fs)
+
+	for i, f := range fs {
+		f.onResolve(func() {
+			if f.err == nil {
+				first.resolve(f.value, nil)
+				return
+			}
+
+			mu.Lock()
+			errs[i] = f.err
+			remaining--
+			last := remaining == 0
+			mu.Unlock()
+
+			if last {
+				var zero T
+				first.resolve(zero, errors.Join(errs...))
+			}
+		})
+	}
+	return first
+}
+
+func main() {
+	ctx := context.Background()
+
+	// the completed channel of the worker becomes a future that can be awaited by several goroutines
+	worker := func(ctx context.Context, ch <-chan string) *Future[int] {
+		return Async(ctx, func(ctx context.Context) (int, error) {
+			n := 0
+			for {
+				select {
+				case _, ok := <-ch:
+					if !ok {
+						return n, nil
+					}
+					n++
+				case <-ctx.Done():
+					return n, ctx.Err()
+				}
+			}
+		})
+	}
+
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, s := range []string{"a", "b", "c"} {
+			ch <- s
+		}
+	}()
+
+	processed := worker(ctx, ch)
+	message := Map(processed, func(n int) string {
+		return fmt.Sprintf("processed %d values", n)
+	})
+	fmt.Println(message.Await(ctx))
+
+	// giving up on a slow future does not block the goroutine producing it
+	slow := Async(ctx, func(ctx context.Context) (string, error) {
+		time.Sleep(100 * time.Millisecond)
+		return "slow", nil
+	})
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	fmt.Println(slow.Await(timeout))
+	fmt.Println(slow.Await(ctx))
+
+	square := func(n int) *Future[int] {
+		return Async(ctx, func(ctx context.Context) (int, error) {
+			time.Sleep(time.Duration(n) * time.Millisecond)
+			return n * n, nil
+		})
+	}
+	fmt.Println(All(square(3), square(1), square(2)).Await(ctx))
+
+	failing := Async(ctx, func(ctx context.Context) (int, error) {
+		return 0, errors.New("replica down")
+	})
+	fmt.Println(Any(failing, square(5)).Await(ctx))
+	fmt.Println(All(failing, square(5)).Await(ctx))
+
+	// resolving a promise a second time has no effect
+	f, resolve := NewPromise[string]()
+	fmt.Println(resolve("first", nil), resolve("second", nil))
+	fmt.Println(f.Await(ctx))
+}
@@ -0,0 +1,3 @@
+module m46
+
+go 1.22.5
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// a weighted semaphore limits concurrent work by cost rather than by count: a heavy job may take several units of the semaphore whereas a light one takes a single unit
+
+// waiters are served strictly in FIFO order; a small request that would fit is not let through while a larger request ahead of it is still waiting, otherwise a steady stream of small requests could starve the large one forever
+
+// the size can be changed while the semaphore is in use; shrinking it below the weight currently held simply makes new requests wait until enough is released
+
+type waiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+type Semaphore struct {
+	mu      sync.Mutex
+	size    int64
+	cur     int64
+	waiting int64
+	waiters list.List // *waiter, oldest first
+}
+
+func NewSemaphore(size int64) *Semaphore {
+	return &Semaphore{size: size}
+}
+
+// Acquire blocks until n units are available or ctx is done; on failure nothing is acquired
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := &waiter{n: n, ready: make(chan struct{})}
+	e := s.waiters.PushBack(w)
+	s.waiting += n
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// acquired at the same time as the context was cancelled
+		return nil
+	default:
+	}
+
+	isFront := s.waiters.Front() == e
+	s.waiters.Remove(e)
+	s.waiting -= n
+
+	// the waiters behind us may fit now that we no longer block them
+	if isFront {
+		s.notify()
+	}
+	return ctx.Err()
+}
+
+// TryAcquire acquires n units without blocking, reporting whether it succeeded
+func (s *Semaphore) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore: released more than held")
+	}
+	s.notify()
+}
+
+// Resize changes the total weight of the semaphore
+func (s *Semaphore) Resize(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size = size
+	s.notify()
+}
+
+// notify wakes waiters in FIFO order for as long as the oldest one fits; it must be called with the lock held
+func (s *Semaphore) notify() {
+	for {
+		e := s.waiters.Front()
+		if e == nil {
+			return
+		}
+
+		w := e.Value.(*waiter)
+		if s.size-s.cur < w.n {
+			return
+		}
+
+		s.cur += w.n
+		s.waiting -= w.n
+		s.waiters.Remove(e)
+		close(w.ready)
+	}
+}
+
+// Current returns the weight currently held
+func (s *Semaphore) Current() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// Waiting returns the total weight requested by blocked callers
+func (s *Semaphore) Waiting() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiting
+}
+
+func (s *Semaphore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func main() {
+	ctx := context.Background()
+	sem := NewSemaphore(10)
+
+	// light jobs keep arriving; the heavy job that arrives in the middle still gets its turn
+	var wg sync.WaitGroup
+	job := func(name string, cost int64) {
+		defer wg.Done()
+
+		if err := sem.Acquire(ctx, cost); err != nil {
+			fmt.Println(name, err)
+			return
+		}
+		defer sem.Release(cost)
+
+		fmt.Printf("%s (cost %d) running, held %d\n", name, cost, sem.Current())
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		if i == 4 {
+			go job("heavy", 10)
+		} else {
+			go job(fmt.Sprintf("light-%d", i), 3)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	fmt.Printf("held %d, waiting %d\n", sem.Current(), sem.Waiting())
+	wg.Wait()
+
+	// a job that is too expensive for the current size waits until the semaphore grows
+	wg.Add(1)
+	go job("huge", 15)
+
+	time.Sleep(20 * time.Millisecond)
+	fmt.Println("try acquire:", sem.TryAcquire(1))
+	fmt.Printf("held %d, waiting %d\n", sem.Current(), sem.Waiting())
+
+	sem.Resize(20)
+	wg.Wait()
+
+	// a caller can give up waiting
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	fmt.Println(sem.Acquire(timeout, 25))
+}
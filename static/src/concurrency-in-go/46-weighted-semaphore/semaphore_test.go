@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquire calls Acquire in a new goroutine, waits until it is queued or done and returns its result
+func acquire(t *testing.T, ctx context.Context, s *Semaphore, n int64) <-chan error {
+	t.Helper()
+	waiting := s.Waiting()
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Acquire(ctx, n)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for s.Waiting() == waiting && len(result) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Acquire(%d) neither queued nor returned", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return result
+}
+
+func acquired(t *testing.T, result <-chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not acquired")
+	}
+}
+
+func blocked(t *testing.T, result <-chan error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		t.Fatalf("acquired out of turn: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestFIFOWithMixedWeights(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(10)
+	s.Acquire(ctx, 10)
+
+	a := acquire(t, ctx, s, 5)
+	b := acquire(t, ctx, s, 8)
+	c := acquire(t, ctx, s, 2)
+
+	s.Release(10)
+	acquired(t, a)
+	// c would fit in what is left, but b is ahead of it
+	blocked(t, c)
+	blocked(t, b)
+
+	s.Release(5)
+	acquired(t, b)
+	acquired(t, c)
+	if cur := s.Current(); cur != 10 {
+		t.Fatalf("current %d, want 10", cur)
+	}
+
+	// nor can TryAcquire jump the queue
+	s.Release(10)
+	d := acquire(t, ctx, s, 1)
+	acquired(t, d)
+	s.Acquire(ctx, 9)
+	e := acquire(t, ctx, s, 5)
+	s.Release(2)
+	if s.TryAcquire(1) {
+		t.Fatal("TryAcquire went ahead of a waiter")
+	}
+	s.Release(8)
+	acquired(t, e)
+}
+
+func TestCancelledHeadUnblocksWaiters(t *testing.T) {
+	s := NewSemaphore(10)
+	s.Acquire(context.Background(), 8)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	head := acquire(t, ctx, s, 5)
+	behind := acquire(t, context.Background(), s, 2)
+	blocked(t, behind)
+
+	cancel()
+	if err := <-head; !errors.Is(err, context.Canceled) {
+		t.Fatalf("head got %v", err)
+	}
+	acquired(t, behind)
+	if cur, waiting := s.Current(), s.Waiting(); cur != 10 || waiting != 0 {
+		t.Fatalf("current %d, waiting %d, want 10 and 0", cur, waiting)
+	}
+}
+
+func TestResize(t *testing.T) {
+	ctx := context.Background()
+	s := NewSemaphore(10)
+	s.Acquire(ctx, 10)
+
+	// growing lets a waiter that did not fit through
+	huge := acquire(t, ctx, s, 15)
+	s.Resize(20)
+	blocked(t, huge)
+	s.Release(5)
+	acquired(t, huge)
+
+	// shrinking below what is held makes new callers wait until enough is released
+	s.Resize(10)
+	small := acquire(t, ctx, s, 1)
+	s.Release(5)
+	blocked(t, small)
+	s.Release(10)
+	acquired(t, small)
+
+	// growing while several wait wakes as many as fit, in order
+	s.Release(s.Current())
+	s.Resize(1)
+	x := acquire(t, ctx, s, 2)
+	y := acquire(t, ctx, s, 3)
+	z := acquire(t, ctx, s, 10)
+	s.Resize(6)
+	acquired(t, x)
+	acquired(t, y)
+	blocked(t, z)
+	if waiting := s.Waiting(); waiting != 10 {
+		t.Fatalf("waiting %d, want 10", waiting)
+	}
+}
@@ -0,0 +1,3 @@
+module m47
+
+go 1.22.5
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// when many goroutines ask for the same slow thing at the same time only one of them needs to do the work; the others wait for it and share its result
+
+// the shared call runs under its own context which keeps the values of the first caller but not its cancellation, so a caller that gives up only stops waiting; the call itself is only cancelled once every caller waiting for it has given up
+
+// a panic in fn is recovered so that it cannot leave the call unfinished and every caller of its key blocked, and is then raised again in each of the callers, as with a call that was not shared
+
+type call[V any] struct {
+	done     chan struct{}
+	val      V
+	err      error
+	panicked *PanicError
+	waiters  int
+	dups     int
+	cancel   context.CancelFunc
+}
+
+// PanicError is what a panicking fn panics with in its callers; Stack is the stack of the goroutine that ran fn
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+type Group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[V]
+
+	executed, deduplicated atomic.Int64
+}
+
+func NewGroup[K comparable, V any]() *Group[K, V] {
+	return &Group[K, V]{calls: make(map[K]*call[V])}
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which case it waits for that call; shared reports whether the result was given to more than one caller
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, shared bool, err error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		c.dups++
+		g.mu.Unlock()
+		g.deduplicated.Add(1)
+		return g.wait(ctx, key, c)
+	}
+
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = c
+	g.mu.Unlock()
+	g.executed.Add(1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.panicked = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+			cancel()
+
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+
+		c.val, c.err = fn(callCtx)
+	}()
+
+	return g.wait(ctx, key, c)
+}
+
+func (g *Group[K, V]) wait(ctx context.Context, key K, c *call[V]) (V, bool, error) {
+	select {
+	case <-c.done:
+		if c.panicked != nil {
+			panic(c.panicked)
+		}
+		g.mu.Lock()
+		shared := c.dups > 0
+		g.mu.Unlock()
+		return c.val, shared, c.err
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c.waiters--
+	if c.waiters == 0 {
+		// no one is interested any more; a later caller must not join a call that is being cancelled
+		c.cancel()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+
+	var zero V
+	return zero, false, ctx.Err()
+}
+
+// Forget makes the next call for key run fn again rather than joining the call in flight; callers already waiting still get its result
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
+
+type Stats struct {
+	Executed     int64 // calls to fn
+	Deduplicated int64 // callers that joined a call already in flight
+}
+
+func (g *Group[K, V]) Stats() Stats {
+	return Stats{
+		Executed:     g.executed.Load(),
+		Deduplicated: g.deduplicated.Load(),
+	}
+}
+
+func locale(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	return "EN/US", nil
+}
+
+type Result struct {
+	Err    error
+	URL    string
+	Body   string
+	Shared bool
+}
+
+// fetchAll fetches each url concurrently; duplicate urls are only requested once
+func fetchAll(done <-chan interface{}, group *Group[string, string], urls ...string) <-chan Result {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	wg.Add(len(urls))
+
+	for _, url := range urls {
+		go func() {
+			defer wg.Done()
+
+			body, shared, err := group.Do(ctx, url, func(ctx context.Context) (string, error) {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				if err != nil {
+					return "", err
+				}
+				response, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return "", err
+				}
+				defer response.Body.Close()
+				b, err := io.ReadAll(response.Body)
+				return string(b), err
+			})
+
+			select {
+			case <-done:
+			case results <- Result{Err: err, URL: url, Body: body, Shared: shared}:
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func main() {
+	ctx := context.Background()
+
+	// a hundred goroutines look up the locale at once but it is only computed once
+	locales := NewGroup[string, string]()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locales.Do(ctx, "locale", locale)
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("locale: %+v\n", locales.Stats())
+
+	// a caller that gives up does not cancel the call for the callers still waiting
+	impatient, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _, err := locales.Do(impatient, "locale", locale)
+		fmt.Println("impatient caller:", err)
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(time.Millisecond)
+		v, shared, err := locales.Do(ctx, "locale", locale)
+		fmt.Println("patient caller:", v, shared, err)
+	}()
+	wg.Wait()
+
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	done := make(chan interface{})
+	defer close(done)
+
+	pages := NewGroup[string, string]()
+	urls := []string{server.URL + "/a", server.URL + "/b", server.URL + "/a", server.URL + "/a", server.URL + "/b"}
+	for r := range fetchAll(done, pages, urls...) {
+		if r.Err != nil {
+			fmt.Printf("error: %v\n", r.Err)
+			continue
+		}
+		fmt.Printf("%s shared=%v\n", r.Body, r.Shared)
+	}
+	fmt.Printf("fetch: %+v, server hits: %d\n", pages.Stats(), hits.Load())
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blocking returns a fn that counts its calls and blocks until release is closed
+func blocking(calls *int, mu *sync.Mutex, release <-chan struct{}) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		*calls++
+		n := *calls
+		mu.Unlock()
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if n > 1 {
+			return "again", nil
+		}
+		return "value", nil
+	}
+}
+
+// joined waits until n callers joined the call in flight
+func joined(t *testing.T, g *Group[string, string], n int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for g.Stats().Deduplicated < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d callers joined, want %d", g.Stats().Deduplicated, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDoDeduplicates(t *testing.T) {
+	g := NewGroup[string, string]()
+	var mu sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	fn := blocking(&calls, &mu, release)
+
+	const callers = 10
+	results := make(chan string, callers)
+	for range callers {
+		go func() {
+			v, shared, err := g.Do(context.Background(), "key", fn)
+			if err != nil || !shared {
+				t.Errorf("got %q, shared %v, %v", v, shared, err)
+			}
+			results <- v
+		}()
+	}
+	joined(t, g, callers-1)
+	close(release)
+
+	for range callers {
+		if v := <-results; v != "value" {
+			t.Fatalf("got %q", v)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("fn ran %d times", calls)
+	}
+}
+
+func TestCallerCancelsOthersGetResult(t *testing.T) {
+	g := NewGroup[string, string]()
+	var mu sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	fn := blocking(&calls, &mu, release)
+
+	patient := make(chan string)
+	go func() {
+		v, _, err := g.Do(context.Background(), "key", fn)
+		if err != nil {
+			t.Error(err)
+		}
+		patient <- v
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	impatient := make(chan error)
+	go func() {
+		_, _, err := g.Do(ctx, "key", fn)
+		impatient <- err
+	}()
+	joined(t, g, 1)
+
+	cancel()
+	if err := <-impatient; !errors.Is(err, context.Canceled) {
+		t.Fatalf("impatient caller got %v", err)
+	}
+
+	close(release)
+	if v := <-patient; v != "value" {
+		t.Fatalf("patient caller got %q", v)
+	}
+}
+
+func TestAllCallersCancelCancelsCall(t *testing.T) {
+	g := NewGroup[string, string]()
+	cancelled := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	g.Do(ctx, "key", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	})
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call was not cancelled once its only caller gave up")
+	}
+}
+
+func TestForget(t *testing.T) {
+	g := NewGroup[string, string]()
+	var mu sync.Mutex
+	var calls int
+	release := make(chan struct{})
+	fn := blocking(&calls, &mu, release)
+
+	first := make(chan string)
+	go func() {
+		v, _, _ := g.Do(context.Background(), "key", fn)
+		first <- v
+	}()
+	running := func(n int) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			mu.Lock()
+			c := calls
+			mu.Unlock()
+			if c == n {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("fn running %d times, want %d", c, n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	running(1)
+
+	g.Forget("key")
+	second := make(chan string)
+	go func() {
+		v, shared, _ := g.Do(context.Background(), "key", fn)
+		if shared {
+			t.Error("call after Forget was shared")
+		}
+		second <- v
+	}()
+	running(2)
+	close(release)
+
+	if a, b := <-first, <-second; a != "value" || b != "again" {
+		t.Fatalf("got %q and %q", a, b)
+	}
+}
+
+func TestPanicIsRaisedInEveryCaller(t *testing.T) {
+	g := NewGroup[string, string]()
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		<-release
+		panic("boom")
+	}
+
+	const callers = 3
+	panics := make(chan any, callers)
+	for range callers {
+		go func() {
+			defer func() { panics <- recover() }()
+			g.Do(context.Background(), "key", fn)
+		}()
+	}
+	joined(t, g, callers-1)
+	close(release)
+
+	for range callers {
+		p, ok := (<-panics).(*PanicError)
+		if !ok || p.Value != "boom" || len(p.Stack) == 0 {
+			t.Fatalf("got panic %v", p)
+		}
+	}
+
+	// the key is free again
+	v, _, err := g.Do(context.Background(), "key", func(ctx context.Context) (string, error) {
+		return "ok", nil
+	})
+	if v != "ok" || err != nil {
+		t.Fatalf("got %q, %v after a panic", v, err)
+	}
+}
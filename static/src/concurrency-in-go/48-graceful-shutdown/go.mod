@@ -0,0 +1,3 @@
+module m48
+
+go 1.22.5
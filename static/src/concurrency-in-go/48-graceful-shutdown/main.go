@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// closing done with defer only helps when main returns normally; on SIGINT or SIGTERM the process is killed and nothing is drained
+
+// the coordinator turns the first signal into the cancellation of a context that the rest of the program derives from, then runs the registered drain hooks in reverse order of registration, so that components are stopped before the components they depend on
+
+// each hook gets its own timeout and a hook that does not return in time is abandoned and reported; if draining as a whole exceeds the global deadline, or a second signal arrives, the process exits immediately
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	drain   func(ctx context.Context) error
+}
+
+type Coordinator struct {
+	Deadline time.Duration
+	Signals  []os.Signal
+	Logger   *log.Logger
+	Exit     func(code int) // forced exit, os.Exit by default
+
+	mu    sync.Mutex
+	hooks []hook
+
+	signals chan os.Signal
+}
+
+func NewCoordinator(deadline time.Duration) *Coordinator {
+	return &Coordinator{
+		Deadline: deadline,
+		Signals:  []os.Signal{os.Interrupt, syscall.SIGTERM},
+		Logger:   log.New(os.Stderr, "shutdown: ", log.Ltime|log.Lmicroseconds),
+		Exit:     os.Exit,
+	}
+}
+
+// Register adds a drain hook; hooks run in reverse order of registration
+func (c *Coordinator) Register(name string, timeout time.Duration, drain func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook{name: name, timeout: timeout, drain: drain})
+}
+
+// Notify returns a context that is cancelled when the first signal arrives; a second signal forces the process to exit
+func (c *Coordinator) Notify(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	c.signals = make(chan os.Signal, 2)
+	signal.Notify(c.signals, c.Signals...)
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-c.signals:
+			c.Logger.Printf("received %v, shutting down", sig)
+			cancel(fmt.Errorf("received %v", sig))
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-c.signals:
+			c.Logger.Printf("received %v again, forcing exit", sig)
+			c.Exit(1)
+		case <-stopped:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(c.signals)
+			close(stopped)
+			cancel(context.Canceled)
+		})
+	}
+}
+
+// Shutdown runs the drain hooks in reverse order and returns the errors of the hooks that failed or timed out
+func (c *Coordinator) Shutdown() error {
+	c.mu.Lock()
+	hooks := append([]hook(nil), c.hooks...)
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Deadline)
+	defer cancel()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+
+		// every hook's context is derived from ctx, so a hook that ignores its context cannot keep the process alive past the deadline
+		err := c.drain(ctx, h)
+
+		if ctx.Err() != nil {
+			pending := hooks[:i+1]
+			if err == nil {
+				pending = hooks[:i]
+			}
+			var names []string
+			for j := len(pending) - 1; j >= 0; j-- {
+				names = append(names, pending[j].name)
+			}
+			c.Logger.Printf("deadline of %v exceeded, forcing exit; not stopped: %v", c.Deadline, names)
+			c.Exit(1)
+			return errors.Join(append(errs, fmt.Errorf("deadline of %v exceeded; not stopped: %v", c.Deadline, names))...)
+		}
+
+		if err != nil {
+			c.Logger.Printf("%s failed to stop after %v: %v", h.name, time.Since(start).Round(time.Millisecond), err)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		c.Logger.Printf("%s stopped in %v", h.name, time.Since(start).Round(time.Millisecond))
+	}
+	return errors.Join(errs...)
+}
+
+// drain runs a single hook, giving up once its timeout expires even if the hook does not return
+func (c *Coordinator) drain(ctx context.Context, h hook) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- h.drain(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run blocks until ctx is cancelled by a signal and then shuts down
+func (c *Coordinator) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return c.Shutdown()
+}
+
+func generator(done <-chan struct{}, integers ...int) <-chan int {
+	ch := make(chan int)
+
+	go func() {
+		defer close(ch)
+		for {
+			for _, v := range integers {
+				select {
+				case <-done:
+					return
+				case ch <- v:
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func multiply(done <-chan struct{}, in <-chan int, multiplier int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case <-done:
+				return
+			case out <- v * multiplier:
+			}
+		}
+	}()
+	return out
+}
+
+func main() {
+	coordinator := NewCoordinator(5 * time.Second)
+
+	ctx, stop := coordinator.Notify(context.Background())
+	defer stop()
+
+	// the pipeline is stopped by the signal rather than by a deferred close
+	pipeline := multiply(ctx.Done(), generator(ctx.Done(), 1, 2, 3, 4), 2)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		sum := 0
+		for v := range pipeline {
+			sum += v
+		}
+		fmt.Println("pipeline drained, sum", sum)
+	}()
+	coordinator.Register("pipeline", time.Second, func(ctx context.Context) error {
+		select {
+		case <-drained:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello")
+	})}
+	go server.Serve(listener)
+	coordinator.Register("http server", 2*time.Second, server.Shutdown)
+
+	// this component ignores its context and is abandoned once its timeout expires
+	coordinator.Register("cache flusher", 500*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	fmt.Printf("listening on %s; press ctrl-c to stop\n", listener.Addr())
+	if err := coordinator.Run(ctx); err != nil {
+		fmt.Println(err)
+	}
+}
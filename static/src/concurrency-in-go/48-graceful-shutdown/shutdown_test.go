@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestCoordinator records forced exits instead of exiting the test binary
+func newTestCoordinator(deadline time.Duration) (*Coordinator, *syncBuffer, chan int) {
+	c := NewCoordinator(deadline)
+	logs := &syncBuffer{}
+	c.Logger = log.New(logs, "", 0)
+	exits := make(chan int, 1)
+	c.Exit = func(code int) { exits <- code }
+	return c, logs, exits
+}
+
+func kill(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(os.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignalCancelsContext(t *testing.T) {
+	c, _, _ := newTestCoordinator(time.Second)
+	ctx, stop := c.Notify(context.Background())
+	defer stop()
+
+	kill(t, syscall.SIGTERM)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not cancelled by SIGTERM")
+	}
+
+	if cause := context.Cause(ctx); cause == nil || !strings.Contains(cause.Error(), "terminated") {
+		t.Fatalf("unexpected cause %v", cause)
+	}
+}
+
+func TestSecondSignalForcesExit(t *testing.T) {
+	c, _, exits := newTestCoordinator(time.Second)
+	ctx, stop := c.Notify(context.Background())
+	defer stop()
+
+	kill(t, syscall.SIGINT)
+	<-ctx.Done()
+	kill(t, syscall.SIGINT)
+
+	select {
+	case code := <-exits:
+		if code != 1 {
+			t.Fatalf("exit code %d, want 1", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not force an exit")
+	}
+}
+
+func TestHooksRunInReverseOrder(t *testing.T) {
+	c, _, _ := newTestCoordinator(time.Second)
+
+	var order []string
+	for _, name := range []string{"database", "queue", "server"} {
+		c.Register(name, time.Second, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	ctx, stop := c.Notify(context.Background())
+	defer stop()
+	kill(t, syscall.SIGTERM)
+
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, ","); got != "server,queue,database" {
+		t.Fatalf("hooks ran in order %s", got)
+	}
+}
+
+func TestHookTimeoutIsReported(t *testing.T) {
+	c, logs, exits := newTestCoordinator(time.Second)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	var ranAfter bool
+	c.Register("database", time.Second, func(ctx context.Context) error {
+		ranAfter = true
+		return nil
+	})
+	c.Register("stuck", 20*time.Millisecond, func(ctx context.Context) error {
+		// ignores its context
+		<-block
+		return nil
+	})
+	c.Register("broken", time.Second, func(ctx context.Context) error {
+		return errors.New("flush failed")
+	})
+
+	err := c.Shutdown()
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "stuck") || !strings.Contains(err.Error(), "flush failed") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !ranAfter {
+		t.Fatal("hooks after the stuck one did not run")
+	}
+	if !strings.Contains(logs.String(), "stuck failed to stop") {
+		t.Fatalf("timeout was not logged:\n%s", logs)
+	}
+
+	select {
+	case <-exits:
+		t.Fatal("unexpected forced exit")
+	default:
+	}
+}
+
+func TestGlobalDeadlineForcesExit(t *testing.T) {
+	c, logs, exits := newTestCoordinator(50 * time.Millisecond)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	var ranAfter bool
+	c.Register("database", time.Second, func(ctx context.Context) error {
+		ranAfter = true
+		return nil
+	})
+	c.Register("slow", time.Second, func(ctx context.Context) error {
+		// ignores its context and outlives the global deadline
+		<-block
+		return nil
+	})
+	c.Register("server", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+
+	err := c.Shutdown()
+	if err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	select {
+	case code := <-exits:
+		if code != 1 {
+			t.Fatalf("exit code %d, want 1", code)
+		}
+	default:
+		t.Fatal("deadline did not force an exit")
+	}
+
+	if ranAfter {
+		t.Fatal("hooks ran after the forced exit")
+	}
+	if !strings.Contains(logs.String(), "not stopped: [slow database]") {
+		t.Fatalf("pending components were not logged:\n%s", logs)
+	}
+}
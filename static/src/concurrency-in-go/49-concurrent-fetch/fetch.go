@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// fetching one url at a time wastes most of the time waiting on the network; a fixed pool of workers fetches many urls at once while the global limit keeps us from opening an unbounded number of connections
+
+// the per-host limit keeps us polite towards any single server; a dispatcher only hands a url to a worker once its host has a free slot, so a worker is never stuck waiting on a busy host while urls for other hosts are queued behind it
+
+// results can be delivered as soon as they complete or in the order the urls were given, in which case early results are held back until everything before them has arrived
+
+// the fetcher owns the response body: it reads it up to a maximum size, closes it and hands over the decoded payload, so a consumer that forgets about the body can no longer keep a connection from being reused; only in streaming mode does the consumer get a reader it must close itself
+
+type Timing struct {
+	DNS     time.Duration // zero when the connection was reused or the host is an ip address
+	Connect time.Duration // zero when the connection was reused
+	TLS     time.Duration
+	TTFB    time.Duration // time from sending the request until the first response byte
+	Total   time.Duration // includes reading the body unless it is streamed
+	Reused  bool
+}
+
+type Result struct {
+	Index    int // position of the url in the input
+	URL      string
+	Err      error
+	Response *http.Response // its body has already been consumed and closed
+	Payload  any            // the body as returned by the decoder of the fetcher
+	Stream   io.ReadCloser  // the body in streaming mode; the consumer must close it
+	Timing   Timing
+}
+
+const DefaultMaxBodySize = 10 << 20
+
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// Decoder turns a response body into a payload
+type Decoder func(r io.Reader) (any, error)
+
+// Bytes returns the body as a []byte
+func Bytes(r io.Reader) (any, error) {
+	return io.ReadAll(r)
+}
+
+// JSON decodes the body into a T
+func JSON[T any]() Decoder {
+	return func(r io.Reader) (any, error) {
+		var v T
+		if err := json.NewDecoder(r).Decode(&v); err != nil {
+			return nil, err
+		}
+		// read the rest so the connection can be reused
+		_, err := io.Copy(io.Discard, r)
+		return v, err
+	}
+}
+
+// Payload returns the payload of a result decoded into a T
+func Payload[T any](r Result) (T, bool) {
+	v, ok := r.Payload.(T)
+	return v, ok
+}
+
+type Fetcher struct {
+	Client      *http.Client
+	Concurrency int   // total requests in flight
+	PerHost     int   // requests in flight per host; zero means no per-host limit
+	Ordered     bool  // deliver results in input order rather than completion order
+	MaxBodySize int64 // bodies larger than this are an error; zero means DefaultMaxBodySize
+	Decode      Decoder
+	Stream      bool // hand over the body as Result.Stream instead of decoding it
+}
+
+// limitedBody fails with ErrBodyTooLarge rather than silently truncating
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (f *Fetcher) maxBodySize() int64 {
+	if f.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return f.MaxBodySize
+}
+
+// consume takes over the body of the response in result
+func (f *Fetcher) consume(result *Result) {
+	body := &limitedBody{ReadCloser: result.Response.Body, remaining: f.maxBodySize()}
+	result.Response.Body = http.NoBody
+
+	if f.Stream {
+		result.Stream = body
+		return
+	}
+	defer body.Close()
+
+	decode := f.Decode
+	if decode == nil {
+		decode = Bytes
+	}
+	payload, err := decode(body)
+	if err != nil {
+		result.Err = fmt.Errorf("%s: %w", result.URL, err)
+		return
+	}
+	result.Payload = payload
+}
+
+type job struct {
+	index int
+	url   string
+	host  string
+}
+
+// fetch performs a single request, recording the phases of the request with httptrace
+func (f *Fetcher) fetch(ctx context.Context, j job) Result {
+	result := Result{Index: j.index, URL: j.url}
+
+	// the transport may finish a dial in the background after the request was served by another connection, so the trace callbacks can race with each other and with us
+	var mu sync.Mutex
+	var timing Timing
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	record := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { timing.DNS = time.Since(dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			record(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			record(func() { timing.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { timing.TLS = time.Since(tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { timing.Reused = info.Reused })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			record(func() { wroteRequest = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { timing.TTFB = time.Since(wroteRequest) })
+		},
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, j.url, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Response, result.Err = f.client().Do(req)
+	if result.Err == nil {
+		f.consume(&result)
+	}
+	record(func() {
+		// phases of a dial that finished in the background do not belong to a reused connection
+		if timing.Reused {
+			timing.DNS, timing.Connect, timing.TLS = 0, 0, 0
+		}
+		timing.Total = time.Since(start)
+		result.Timing = timing
+	})
+	return result
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client == nil {
+		return http.DefaultClient
+	}
+	return f.Client
+}
+
+// discard releases the connection of a result that will never be delivered
+func discard(r Result) {
+	if r.Stream != nil {
+		r.Stream.Close()
+	}
+}
+
+func (f *Fetcher) FetchAll(ctx context.Context, urls ...string) <-chan Result {
+	results := make(chan Result)
+	completed := make(chan Result)
+	jobs := make(chan job)
+	finished := make(chan string) // host of each completed job
+
+	for i := 0; i < max(f.Concurrency, 1); i++ {
+		go func() {
+			for j := range jobs {
+				r := f.fetch(ctx, j)
+				select {
+				case <-ctx.Done():
+					discard(r)
+				case completed <- r:
+				}
+
+				select {
+				case <-ctx.Done():
+				case finished <- j.host:
+				}
+			}
+		}()
+	}
+
+	// the dispatcher hands out jobs whose host has capacity
+	go func() {
+		defer close(jobs)
+
+		pending := make(map[string][]job)
+		var hosts []string // hosts with pending jobs, in order of first appearance
+		inFlight := make(map[string]int)
+
+		for i, raw := range urls {
+			host := raw
+			if u, err := url.Parse(raw); err == nil {
+				host = u.Host
+			}
+			if _, ok := pending[host]; !ok {
+				hosts = append(hosts, host)
+			}
+			pending[host] = append(pending[host], job{index: i, url: raw, host: host})
+		}
+
+		remaining := len(urls)
+		for remaining > 0 {
+			// pick the first host that has both pending jobs and a free slot, rotating so that hosts take turns
+			var next job
+			var out chan<- job
+			for i, host := range hosts {
+				if len(pending[host]) > 0 && (f.PerHost == 0 || inFlight[host] < f.PerHost) {
+					next = pending[host][0]
+					out = jobs
+					hosts = append(append(hosts[:i:i], hosts[i+1:]...), host)
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- next:
+				pending[next.host] = pending[next.host][1:]
+				inFlight[next.host]++
+			case host := <-finished:
+				inFlight[host]--
+				remaining--
+			}
+		}
+	}()
+
+	// the collector forwards results, reordering them if needed
+	go func() {
+		defer close(results)
+
+		held := make(map[int]Result)
+		defer func() {
+			for _, r := range held {
+				discard(r)
+			}
+		}()
+
+		send := func(r Result) bool {
+			select {
+			case <-ctx.Done():
+				discard(r)
+				return false
+			case results <- r:
+				return true
+			}
+		}
+
+		next := 0
+		for range urls {
+			var r Result
+			select {
+			case <-ctx.Done():
+				return
+			case r = <-completed:
+			}
+
+			if !f.Ordered {
+				if !send(r) {
+					return
+				}
+				continue
+			}
+
+			held[r.Index] = r
+			for {
+				r, ok := held[next]
+				if !ok {
+					break
+				}
+				delete(held, next)
+				next++
+				if !send(r) {
+					return
+				}
+			}
+		}
+	}()
+
+	return results
+}
+
+// fetchAll keeps the signature of the error handling example: cancellation through a done channel
+func fetchAll(done <-chan interface{}, f *Fetcher, urls ...string) <-chan Result {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+	return f.FetchAll(ctx, urls...)
+}
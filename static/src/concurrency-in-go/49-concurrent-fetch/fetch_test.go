@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// limitServer records the peak number of requests it was serving at once
+type limitServer struct {
+	*httptest.Server
+	inFlight, peak atomic.Int64
+}
+
+func newLimitServer(t *testing.T, delay func(path string) time.Duration) *limitServer {
+	s := &limitServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		for {
+			peak := s.peak.Load()
+			if n <= peak || s.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+
+		select {
+		case <-time.After(delay(r.URL.Path)):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func constant(d time.Duration) func(string) time.Duration {
+	return func(string) time.Duration { return d }
+}
+
+func urls(s *httptest.Server, n int) []string {
+	var us []string
+	for i := 0; i < n; i++ {
+		us = append(us, fmt.Sprintf("%s/%d", s.URL, i))
+	}
+	return us
+}
+
+func collect(t *testing.T, results <-chan Result) []Result {
+	t.Helper()
+	var rs []Result
+	for r := range results {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.URL, r.Err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestFetchAllGlobalLimit(t *testing.T) {
+	s := newLimitServer(t, constant(20*time.Millisecond))
+
+	f := &Fetcher{Concurrency: 3}
+	rs := collect(t, f.FetchAll(context.Background(), urls(s.Server, 20)...))
+
+	if len(rs) != 20 {
+		t.Fatalf("got %d results, want 20", len(rs))
+	}
+	if peak := s.peak.Load(); peak != 3 {
+		t.Fatalf("peak concurrency %d, want 3", peak)
+	}
+}
+
+func TestFetchAllPerHostLimit(t *testing.T) {
+	slow := newLimitServer(t, constant(50*time.Millisecond))
+	fast := newLimitServer(t, constant(time.Millisecond))
+
+	f := &Fetcher{Concurrency: 8, PerHost: 2}
+	start := time.Now()
+	results := f.FetchAll(context.Background(), append(urls(slow.Server, 8), urls(fast.Server, 8)...)...)
+
+	// the slow host must not hold up the fast one even though its urls come first
+	var fastDone time.Duration
+	seenFast := 0
+	for r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Index >= 8 {
+			seenFast++
+			if seenFast == 8 {
+				fastDone = time.Since(start)
+			}
+		}
+	}
+
+	if slow.peak.Load() > 2 || fast.peak.Load() > 2 {
+		t.Fatalf("per-host peak %d/%d exceeds limit", slow.peak.Load(), fast.peak.Load())
+	}
+	if fastDone > 150*time.Millisecond {
+		t.Fatalf("fast host finished after %v; blocked behind slow host", fastDone)
+	}
+}
+
+func TestFetchAllOrdered(t *testing.T) {
+	// earlier urls are slower so completion order is the reverse of input order
+	s := newLimitServer(t, func(path string) time.Duration {
+		var i int
+		fmt.Sscanf(path, "/%d", &i)
+		return time.Duration(10-i) * 5 * time.Millisecond
+	})
+
+	f := &Fetcher{Concurrency: 10, Ordered: true}
+	rs := collect(t, f.FetchAll(context.Background(), urls(s.Server, 10)...))
+	for i, r := range rs {
+		if r.Index != i {
+			t.Fatalf("result %d has index %d", i, r.Index)
+		}
+	}
+
+	f.Ordered = false
+	rs = collect(t, f.FetchAll(context.Background(), urls(s.Server, 10)...))
+	if rs[0].Index == 0 {
+		t.Fatalf("expected completion order, got index 0 first")
+	}
+}
+
+func TestFetchAllTiming(t *testing.T) {
+	s := newLimitServer(t, constant(20*time.Millisecond))
+
+	f := &Fetcher{Concurrency: 1, Client: &http.Client{Transport: &http.Transport{}}}
+	rs := collect(t, f.FetchAll(context.Background(), urls(s.Server, 2)...))
+
+	first, second := rs[0].Timing, rs[1].Timing
+	if first.Reused || first.Connect == 0 {
+		t.Errorf("first request should dial a new connection: %+v", first)
+	}
+	if !second.Reused || second.Connect != 0 {
+		t.Errorf("second request should reuse the connection: %+v", second)
+	}
+	for _, timing := range []Timing{first, second} {
+		if timing.TTFB < 20*time.Millisecond || timing.Total < timing.TTFB {
+			t.Errorf("unexpected timing %+v", timing)
+		}
+	}
+}
+
+func TestFetchAllCancel(t *testing.T) {
+	s := newLimitServer(t, constant(time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Fetcher{Concurrency: 2}
+	results := f.FetchAll(ctx, urls(s.Server, 10)...)
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for range results {
+		}
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second / 2):
+		t.Fatal("results were not closed after cancellation")
+	}
+}
+
+func TestFetchAllDoneChannel(t *testing.T) {
+	s := newLimitServer(t, constant(time.Millisecond))
+
+	done := make(chan interface{})
+	defer close(done)
+
+	rs := collect(t, fetchAll(done, &Fetcher{Concurrency: 2}, urls(s.Server, 5)...))
+	if len(rs) != 5 {
+		t.Fatalf("got %d results, want 5", len(rs))
+	}
+}
+
+// connServer serves a body of the given size and counts the connections it accepted
+type connServer struct {
+	*httptest.Server
+	conns atomic.Int64
+}
+
+func newConnServer(t *testing.T, size int) *connServer {
+	s := &connServer{}
+	body := strings.Repeat("x", size)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.conns.Add(1)
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestFetchAllReusesConnections(t *testing.T) {
+	// the body is too large to be buffered by the transport, so the connection is only reused if it is read to the end
+	s := newConnServer(t, 256*1024)
+
+	f := &Fetcher{Concurrency: 1, Client: &http.Client{Transport: &http.Transport{}}}
+	rs := collect(t, f.FetchAll(context.Background(), urls(s.Server, 10)...))
+
+	for _, r := range rs {
+		if body, ok := Payload[[]byte](r); !ok || len(body) != 256*1024 {
+			t.Fatalf("%s: payload of %d bytes", r.URL, len(body))
+		}
+		if r.Index > 0 && !r.Timing.Reused {
+			t.Errorf("%s did not reuse the connection", r.URL)
+		}
+	}
+	if n := s.conns.Load(); n != 1 {
+		t.Fatalf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestFetchAllStream(t *testing.T) {
+	s := newConnServer(t, 256*1024)
+
+	f := &Fetcher{Concurrency: 1, Stream: true, Client: &http.Client{Transport: &http.Transport{}}}
+	for r := range f.FetchAll(context.Background(), urls(s.Server, 10)...) {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		n, err := io.Copy(io.Discard, r.Stream)
+		r.Stream.Close()
+		if err != nil || n != 256*1024 {
+			t.Fatalf("%s: read %d bytes: %v", r.URL, n, err)
+		}
+	}
+
+	// the worker may start the next request before the previous stream was closed
+	if n := s.conns.Load(); n > 2 {
+		t.Fatalf("server accepted %d connections, want at most 2", n)
+	}
+}
+
+func TestFetchAllMaxBodySize(t *testing.T) {
+	s := newConnServer(t, 1024)
+
+	f := &Fetcher{Concurrency: 1, MaxBodySize: 1024}
+	rs := collect(t, f.FetchAll(context.Background(), urls(s.Server, 1)...))
+	if body, _ := Payload[[]byte](rs[0]); len(body) != 1024 {
+		t.Fatalf("payload of %d bytes, want 1024", len(body))
+	}
+
+	f.MaxBodySize = 1000
+	for r := range f.FetchAll(context.Background(), urls(s.Server, 1)...) {
+		if !errors.Is(r.Err, ErrBodyTooLarge) {
+			t.Fatalf("got %v, want ErrBodyTooLarge", r.Err)
+		}
+	}
+
+	f.Stream = true
+	for r := range f.FetchAll(context.Background(), urls(s.Server, 1)...) {
+		n, err := io.Copy(io.Discard, r.Stream)
+		r.Stream.Close()
+		if !errors.Is(err, ErrBodyTooLarge) || n != 1000 {
+			t.Fatalf("read %d bytes: %v, want 1000 bytes and ErrBodyTooLarge", n, err)
+		}
+	}
+}
+
+func TestFetchAllJSON(t *testing.T) {
+	type page struct {
+		Path string `json:"path"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			fmt.Fprint(w, "not json")
+			return
+		}
+		json.NewEncoder(w).Encode(page{Path: r.URL.Path})
+	}))
+	defer server.Close()
+
+	f := &Fetcher{Concurrency: 2, Ordered: true, Decode: JSON[page]()}
+	var got []string
+	for r := range f.FetchAll(context.Background(), server.URL+"/a", server.URL+"/bad", server.URL+"/b") {
+		if r.Err != nil {
+			got = append(got, "error")
+			continue
+		}
+		p, ok := Payload[page](r)
+		if !ok {
+			t.Fatalf("payload has type %T", r.Payload)
+		}
+		got = append(got, p.Path)
+	}
+
+	if strings.Join(got, " ") != "/a error /b" {
+		t.Fatalf("got %v", got)
+	}
+}
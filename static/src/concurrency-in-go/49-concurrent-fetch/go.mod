@@ -0,0 +1,3 @@
+module m49
+
+go 1.22.5
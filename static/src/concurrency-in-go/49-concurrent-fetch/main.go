@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+func main() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(10+rand.Intn(50)) * time.Millisecond)
+		fmt.Fprintln(w, "ok")
+	})
+
+	a := httptest.NewServer(handler)
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	urls := []string{"http://badhost.invalid"}
+	for i := 0; i < 5; i++ {
+		urls = append(urls, a.URL+fmt.Sprintf("/%d", i), b.URL+fmt.Sprintf("/%d", i))
+	}
+
+	done := make(chan interface{})
+	defer close(done)
+
+	fetcher := &Fetcher{Concurrency: 4, PerHost: 2, Ordered: true}
+	errCount := 0
+
+	start := time.Now()
+	for r := range fetchAll(done, fetcher, urls...) {
+		if r.Err != nil {
+			fmt.Printf("%2d error: %v\n", r.Index, r.Err)
+			errCount++
+			if errCount >= 3 {
+				fmt.Println("Too many errors!")
+				break
+			}
+			continue
+		}
+		body, _ := Payload[[]byte](r)
+
+		t := r.Timing
+		fmt.Printf("%2d %s %v %dB dns=%v connect=%v ttfb=%v total=%v reused=%v\n",
+			r.Index, r.URL, r.Response.Status, len(body),
+			t.DNS.Round(time.Microsecond), t.Connect.Round(time.Microsecond),
+			t.TTFB.Round(time.Millisecond), t.Total.Round(time.Millisecond), t.Reused)
+	}
+	fmt.Printf("fetched %d urls in %v\n", len(urls), time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,3 @@
+module m50
+
+go 1.22.5
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// a failed request is often worth trying again, but only if the error is transient: a timeout, a reset connection or a 5xx response may succeed on the next attempt whereas a 404 or a malformed url never will
+
+// a timeout of a single attempt, such as one set by http.Client.Timeout, is transient too; only once the caller's own context is done is there no point trying again
+
+// retries are spaced out with exponential backoff and randomized with jitter so that many clients failing at the same moment do not all retry in lockstep; full jitter picks a delay anywhere up to the exponential bound whereas decorrelated jitter grows from the previous delay
+
+// a retry budget caps how many retries may be made within a time window; without it, every client retrying every request multiplies the load on a server that is already struggling
+
+type Jitter int
+
+const (
+	FullJitter Jitter = iota
+	DecorrelatedJitter
+)
+
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // also caps Retry-After
+	Jitter      Jitter
+	Budget      *Budget // optional; shared between all calls using the policy
+}
+
+// Budget allows at most Max retries within any window of the given length
+type Budget struct {
+	Max    int
+	Window time.Duration
+
+	mu      sync.Mutex
+	retries []time.Time
+}
+
+func NewBudget(max int, window time.Duration) *Budget {
+	return &Budget{Max: max, Window: window}
+}
+
+func (b *Budget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for len(b.retries) > 0 && now.Sub(b.retries[0]) >= b.Window {
+		b.retries = b.retries[1:]
+	}
+	if len(b.retries) >= b.Max {
+		return false
+	}
+	b.retries = append(b.retries, now)
+	return true
+}
+
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// StatusError reports an http response that was not successful
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // zero if the response had no Retry-After header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Retryable reports whether err is a transient failure
+func Retryable(err error) bool {
+	var permanent *permanentError
+	var status *StatusError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &permanent):
+		return false
+	case errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &status):
+		return status.StatusCode >= 500 || status.StatusCode == http.StatusTooManyRequests
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		// the attempt timed out; whether the caller's context did is checked by Retry
+		return true
+	case errors.As(err, &netErr):
+		return netErr.Timeout()
+	}
+	return false
+}
+
+func retryAfter(err error) time.Duration {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.RetryAfter
+	}
+	return 0
+}
+
+func (p Policy) backoff(attempt int, prev time.Duration) time.Duration {
+	var d time.Duration
+	switch p.Jitter {
+	case DecorrelatedJitter:
+		// sleep = min(cap, random_between(base, prev * 3))
+		upper := max(3*prev, p.BaseDelay+1)
+		d = p.BaseDelay + time.Duration(rand.Int63n(int64(upper-p.BaseDelay)))
+	default:
+		// sleep = random_between(0, min(cap, base * 2 ^ attempt))
+		upper := p.BaseDelay << min(attempt, 32)
+		if upper <= 0 || upper > p.MaxDelay {
+			upper = p.MaxDelay
+		}
+		d = time.Duration(rand.Int63n(int64(upper) + 1))
+	}
+	return min(d, p.MaxDelay)
+}
+
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Retry calls fn until it succeeds, returns a permanent error, the attempts or the budget run out, or ctx is done
+func Retry[T any](ctx context.Context, p Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	delay := p.BaseDelay
+
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil {
+			return v, nil
+		}
+
+		if ctx.Err() != nil {
+			return zero, &RetryError{Attempts: attempt, Err: errors.Join(ctx.Err(), err)}
+		}
+		if !Retryable(err) || attempt >= p.MaxAttempts {
+			return zero, &RetryError{Attempts: attempt, Err: err}
+		}
+		if p.Budget != nil && !p.Budget.allow() {
+			return zero, &RetryError{Attempts: attempt, Err: errors.Join(ErrBudgetExhausted, err)}
+		}
+
+		delay = p.backoff(attempt, delay)
+		// the server knows best when it will be ready again, but a huge Retry-After must not park the caller for hours
+		if ra := retryAfter(err); ra > 0 {
+			delay = min(ra, p.MaxDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, &RetryError{Attempts: attempt, Err: errors.Join(ctx.Err(), err)}
+		case <-time.After(delay):
+		}
+	}
+}
+
+// parseRetryAfter accepts both forms of the header: a number of seconds or an http date
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// Get is http.Get with retries; responses with a 4xx or 5xx status are turned into a *StatusError
+func Get(ctx context.Context, client *http.Client, p Policy, url string) (*http.Response, error) {
+	return Retry(ctx, p, func(ctx context.Context) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+
+		response, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if response.StatusCode >= 400 {
+			// drain the body so the connection can be reused for the next attempt
+			io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+			response.Body.Close()
+			return nil, &StatusError{
+				StatusCode: response.StatusCode,
+				RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+			}
+		}
+		return response, nil
+	})
+}
+
+type Result struct {
+	Err      error
+	Response *http.Response
+}
+
+func fetchAll(done <-chan interface{}, p Policy, urls ...string) <-chan Result {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		for _, url := range urls {
+			response, err := Get(ctx, http.DefaultClient, p, url)
+			result := Result{Err: err, Response: response}
+			select {
+			case <-done:
+				return
+			case results <- result:
+			}
+		}
+	}()
+
+	return results
+}
+
+func main() {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/flaky":
+			// the first two requests fail
+			if n <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/busy":
+			if n%2 == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		case "/reset":
+			// close the connection without responding; a bare EOF is not retried because the server may already have acted on the request
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer server.Close()
+
+	policy := Policy{
+		MaxAttempts: 4,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Jitter:      DecorrelatedJitter,
+		Budget:      NewBudget(10, time.Minute),
+	}
+
+	done := make(chan interface{})
+	defer close(done)
+
+	urls := []string{server.URL + "/flaky", server.URL + "/busy", server.URL + "/missing", server.URL + "/reset"}
+	for r := range fetchAll(done, policy, urls...) {
+		if r.Err != nil {
+			fmt.Printf("error: %v\n", r.Err)
+			continue
+		}
+		fmt.Printf("%v %v\n", r.Response.Request.URL.Path, r.Response.Status)
+		r.Response.Body.Close()
+	}
+
+	// Retry works around any function, not only http requests
+	attempts := 0
+	v, err := Retry(context.Background(), Policy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}, func(ctx context.Context) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, syscall.ECONNRESET
+		}
+		return 42, nil
+	})
+	fmt.Println(v, err, "attempts:", attempts)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	p := Policy{BaseDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+
+	for attempt := 1; attempt <= 40; attempt++ {
+		// the exponential bound overflows long before attempt 40
+		upper := p.MaxDelay
+		if d := p.BaseDelay << attempt; d > 0 && d < upper {
+			upper = d
+		}
+		for range 100 {
+			if d := p.backoff(attempt, 0); d < 0 || d > upper {
+				t.Fatalf("full jitter: attempt %d slept %v, want at most %v", attempt, d, upper)
+			}
+		}
+	}
+
+	p.Jitter = DecorrelatedJitter
+	prev := p.BaseDelay
+	for range 1000 {
+		d := p.backoff(0, prev)
+		if d < p.BaseDelay || d > min(3*prev, p.MaxDelay) {
+			t.Fatalf("decorrelated jitter: slept %v after %v", d, prev)
+		}
+		prev = d
+	}
+}
+
+func TestBudget(t *testing.T) {
+	const window = 50 * time.Millisecond
+	b := NewBudget(2, window)
+
+	if !b.allow() || !b.allow() {
+		t.Fatal("retries within the budget were refused")
+	}
+	if b.allow() {
+		t.Fatal("retry beyond the budget was allowed")
+	}
+
+	time.Sleep(window + 10*time.Millisecond)
+	if !b.allow() {
+		t.Fatal("budget did not recover after the window")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for header, want := range map[string]time.Duration{
+		"":                              0,
+		"0":                             0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"1.5":                           0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0, // in the past
+	} {
+		if got := parseRetryAfter(header); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 8*time.Second || got > 10*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v", date, got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	// a real client timeout wraps context.DeadlineExceeded
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	_, timeout := (&http.Client{Timeout: 10 * time.Millisecond}).Get(slow.URL)
+
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&StatusError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{&url.Error{Op: "Get", URL: "http://example.com", Err: syscall.ECONNREFUSED}, true},
+		{timeout, true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{io.EOF, false},
+		{Permanent(syscall.ECONNRESET), false},
+		{errors.New("malformed"), false},
+	} {
+		if got := Retryable(test.err); got != test.want {
+			t.Errorf("Retryable(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+var fast = Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	v, err := Retry(context.Background(), fast, func(ctx context.Context) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, syscall.ECONNRESET
+		}
+		return 42, nil
+	})
+	if v != 42 || err != nil || attempts != 3 {
+		t.Fatalf("got %v, %v after %d attempts", v, err, attempts)
+	}
+
+	// attempts run out
+	attempts = 0
+	_, err = Retry(context.Background(), fast, func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, syscall.ECONNRESET
+	})
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 || !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// a permanent error is not retried
+	attempts = 0
+	Retry(context.Background(), fast, func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, &StatusError{StatusCode: http.StatusNotFound}
+	})
+	if attempts != 1 {
+		t.Fatalf("permanent error tried %d times", attempts)
+	}
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	p := fast
+	p.MaxAttempts = 10
+	p.Budget = NewBudget(2, time.Minute)
+
+	attempts := 0
+	_, err := Retry(context.Background(), p, func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, syscall.ECONNRESET
+	})
+	if !errors.Is(err, ErrBudgetExhausted) || attempts != 3 {
+		t.Fatalf("got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	p := fast
+	p.MaxAttempts = 100
+	attempts := 0
+	_, err := Retry(ctx, p, func(ctx context.Context) (int, error) {
+		attempts++
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || attempts != 1 {
+		t.Fatalf("got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestGetRetriesClientTimeout(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request is slower than the client timeout
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	response, err := Get(context.Background(), client, fast, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("%d requests, want 2", n)
+	}
+}
+
+func TestGetHonoursRetryAfter(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	p := fast
+	p.MaxDelay = 2 * time.Second
+	start := time.Now()
+	response, err := Get(context.Background(), http.DefaultClient, p, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %v, before Retry-After", elapsed)
+	}
+}
+
+func TestRetryAfterIsCappedByMaxDelay(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	response, err := Get(context.Background(), http.DefaultClient, fast, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waited %v despite MaxDelay of %v", elapsed, fast.MaxDelay)
+	}
+}
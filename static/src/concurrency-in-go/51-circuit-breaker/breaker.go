@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// a circuit breaker stops sending requests to a host that keeps failing; rather than waiting for yet another timeout the caller fails fast, and the host gets a chance to recover without being hammered
+
+// while closed, the outcome of every request is recorded in a rolling window of time buckets; once enough requests in the window have been seen and the failure rate crosses the threshold the breaker opens
+
+// while open, every request fails immediately with ErrOpen; after OpenTimeout the breaker becomes half-open and lets a few probe requests through, closing again if they all succeed and opening again if any of them fails
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Clock is injected so that tests can move time forward without sleeping
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// a zero or invalid field of Settings is replaced by its default
+type Settings struct {
+	Window      time.Duration // length of the rolling window
+	Buckets     int           // number of buckets the window is divided into
+	MinRequests int           // requests in the window before the failure rate is considered
+	FailureRate float64       // fraction of failed requests that opens the breaker
+	OpenTimeout time.Duration // time spent open before probing
+	Probes      int           // successful probes needed to close from half-open
+
+	// OnStateChange is called without holding the breaker's lock
+	OnStateChange func(name string, from, to State)
+	Clock         Clock
+}
+
+type bucket struct {
+	start               time.Time
+	successes, failures int
+}
+
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu       sync.Mutex
+	state    State
+	gen      uint64 // incremented on every state change so late outcomes from an old state are ignored
+	buckets  []bucket
+	openedAt time.Time
+	probing  int // probes in flight
+	probed   int // successful probes
+}
+
+func NewBreaker(name string, s Settings) *Breaker {
+	if s.Clock == nil {
+		s.Clock = realClock{}
+	}
+	if s.Window <= 0 {
+		s.Window = 10 * time.Second
+	}
+	if s.Buckets <= 0 {
+		s.Buckets = 10
+	}
+	// a bucket must be at least a nanosecond wide
+	s.Buckets = int(min(int64(s.Buckets), int64(s.Window)))
+	if s.MinRequests <= 0 {
+		s.MinRequests = 10
+	}
+	if s.FailureRate <= 0 || s.FailureRate > 1 {
+		s.FailureRate = 0.5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 5 * time.Second
+	}
+	s.Probes = max(s.Probes, 1)
+	return &Breaker{name: name, settings: s, buckets: make([]bucket, s.Buckets)}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	changes := b.advance(b.settings.Clock.Now())
+	state := b.state
+	b.mu.Unlock()
+	b.notify(changes)
+	return state
+}
+
+// current returns the bucket for now, resetting buckets that have fallen out of the window
+func (b *Breaker) current(now time.Time) *bucket {
+	width := b.settings.Window / time.Duration(len(b.buckets))
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%int64(len(b.buckets))]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *Breaker) counts(now time.Time) (successes, failures int) {
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.settings.Window {
+			successes += bk.successes
+			failures += bk.failures
+		}
+	}
+	return successes, failures
+}
+
+// transitions are collected while holding the lock and reported once it is released
+type transition struct {
+	from, to State
+}
+
+func (b *Breaker) setState(to State, now time.Time, changes *[]transition) {
+	if b.state == to {
+		return
+	}
+	*changes = append(*changes, transition{from: b.state, to: to})
+	b.state = to
+	b.gen++
+	b.probing, b.probed = 0, 0
+
+	switch to {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+}
+
+// advance moves an open breaker to half-open once its timeout has passed
+func (b *Breaker) advance(now time.Time) []transition {
+	var changes []transition
+	if b.state == Open && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.setState(HalfOpen, now, &changes)
+	}
+	return changes
+}
+
+func (b *Breaker) notify(changes []transition) {
+	if b.settings.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.settings.OnStateChange(b.name, c.from, c.to)
+	}
+}
+
+// Allow reports whether a request may be made; if so, done must be called with its outcome
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	gen, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.record(gen, success) })
+	}, nil
+}
+
+func (b *Breaker) allow() (gen uint64, err error) {
+	b.mu.Lock()
+	now := b.settings.Clock.Now()
+	changes := b.advance(now)
+
+	switch {
+	case b.state == Open:
+		err = ErrOpen
+	case b.state == HalfOpen && b.probing+b.probed >= b.settings.Probes:
+		// enough probes are already in flight
+		err = ErrOpen
+	case b.state == HalfOpen:
+		b.probing++
+	}
+	gen = b.gen
+	b.mu.Unlock()
+	b.notify(changes)
+	return gen, err
+}
+
+// release gives back an allowed request without recording an outcome; a caller that gave up says nothing about the health of the host
+func (b *Breaker) release(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen == b.gen && b.state == HalfOpen {
+		b.probing--
+	}
+}
+
+func (b *Breaker) record(gen uint64, success bool) {
+	b.mu.Lock()
+	now := b.settings.Clock.Now()
+	var changes []transition
+
+	if gen == b.gen {
+		switch b.state {
+		case Closed:
+			bk := b.current(now)
+			if success {
+				bk.successes++
+			} else {
+				bk.failures++
+				successes, failures := b.counts(now)
+				total := successes + failures
+				if total >= b.settings.MinRequests && float64(failures)/float64(total) >= b.settings.FailureRate {
+					b.setState(Open, now, &changes)
+				}
+			}
+		case HalfOpen:
+			b.probing--
+			if !success {
+				b.setState(Open, now, &changes)
+			} else if b.probed++; b.probed >= b.settings.Probes {
+				b.setState(Closed, now, &changes)
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.notify(changes)
+}
+
+// Do runs fn if the breaker allows it and records whether it returned an error, unless ctx was done by then
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	if ctx.Err() != nil {
+		b.release(gen)
+	} else {
+		b.record(gen, err == nil)
+	}
+	return err
+}
+
+// OpenError is returned by Transport when the breaker of a host is open
+type OpenError struct {
+	Host string
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Host, ErrOpen)
+}
+
+func (e *OpenError) Unwrap() error {
+	return ErrOpen
+}
+
+// Transport keeps a separate breaker per host; transport errors and 5xx responses count as failures
+type Transport struct {
+	Transport http.RoundTripper
+	Settings  Settings
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func (t *Transport) breaker(host string) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.breakers == nil {
+		t.breakers = make(map[string]*Breaker)
+	}
+	b, ok := t.breakers[host]
+	if !ok {
+		b = NewBreaker(host, t.Settings)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	b := t.breaker(req.URL.Host)
+	gen, err := b.allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &OpenError{Host: req.URL.Host}
+	}
+
+	response, err := transport.RoundTrip(req)
+	// a request the caller cancelled or let time out must not open the breaker of a healthy host
+	if req.Context().Err() != nil {
+		b.release(gen)
+	} else {
+		b.record(gen, err == nil && response.StatusCode < 500)
+	}
+	return response, err
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var errFail = errors.New("fail")
+
+func settings(clock Clock) Settings {
+	return Settings{
+		Window:      10 * time.Second,
+		Buckets:     10,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		OpenTimeout: 5 * time.Second,
+		Probes:      2,
+		Clock:       clock,
+	}
+}
+
+func outcome(b *Breaker, success bool) error {
+	return b.Do(context.Background(), func(ctx context.Context) error {
+		if success {
+			return nil
+		}
+		return errFail
+	})
+}
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	b := NewBreaker("test", settings(newFakeClock()))
+
+	// three failures are below the minimum number of requests
+	for i := 0; i < 3; i++ {
+		outcome(b, false)
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v after too few requests, want closed", s)
+	}
+
+	outcome(b, false)
+	if s := b.State(); s != Open {
+		t.Fatalf("state %v, want open", s)
+	}
+	if err := outcome(b, true); !errors.Is(err, ErrOpen) {
+		t.Fatalf("got %v, want ErrOpen", err)
+	}
+}
+
+func TestBreakerStaysClosedBelowRate(t *testing.T) {
+	b := NewBreaker("test", settings(newFakeClock()))
+
+	for i := 0; i < 20; i++ {
+		outcome(b, i%3 == 0 || i%3 == 1) // one failure in three
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v, want closed", s)
+	}
+}
+
+func TestBreakerWindowExpires(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBreaker("test", settings(clock))
+
+	for i := 0; i < 3; i++ {
+		outcome(b, false)
+	}
+	// the failures fall out of the window before the next one is recorded
+	clock.Advance(11 * time.Second)
+	outcome(b, false)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v, want closed once old failures expired", s)
+	}
+
+	// failures spread within the window still count
+	for i := 0; i < 3; i++ {
+		clock.Advance(2 * time.Second)
+		outcome(b, false)
+	}
+	if s := b.State(); s != Open {
+		t.Fatalf("state %v, want open", s)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBreaker("test", settings(clock))
+	for i := 0; i < 4; i++ {
+		outcome(b, false)
+	}
+
+	clock.Advance(4 * time.Second)
+	if s := b.State(); s != Open {
+		t.Fatalf("state %v before timeout, want open", s)
+	}
+	clock.Advance(time.Second)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state %v after timeout, want half-open", s)
+	}
+
+	// only as many probes as are needed to close are let through
+	done1, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("third probe got %v, want ErrOpen", err)
+	}
+
+	done1(true)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state %v after one probe, want half-open", s)
+	}
+	done2(true)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v after probes succeeded, want closed", s)
+	}
+
+	// the window was reset when the breaker closed
+	for i := 0; i < 3; i++ {
+		outcome(b, false)
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v, want closed", s)
+	}
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBreaker("test", settings(clock))
+	for i := 0; i < 4; i++ {
+		outcome(b, false)
+	}
+	clock.Advance(5 * time.Second)
+
+	outcome(b, false)
+	if s := b.State(); s != Open {
+		t.Fatalf("state %v after failed probe, want open", s)
+	}
+
+	// the timeout starts over from the failed probe
+	clock.Advance(4 * time.Second)
+	if s := b.State(); s != Open {
+		t.Fatalf("state %v, want open", s)
+	}
+}
+
+func TestBreakerIgnoresStaleOutcomes(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBreaker("test", settings(clock))
+
+	// a request started while closed finishes after the breaker opened and moved to half-open
+	slow, _ := b.Allow()
+	for i := 0; i < 4; i++ {
+		outcome(b, false)
+	}
+	clock.Advance(5 * time.Second)
+	b.State()
+
+	slow(false)
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state %v, want half-open", s)
+	}
+}
+
+func TestBreakerStateChanges(t *testing.T) {
+	clock := newFakeClock()
+	s := settings(clock)
+	var changes []string
+	s.OnStateChange = func(name string, from, to State) {
+		changes = append(changes, name+":"+from.String()+"->"+to.String())
+	}
+	b := NewBreaker("api", s)
+
+	for i := 0; i < 4; i++ {
+		outcome(b, false)
+	}
+	clock.Advance(5 * time.Second)
+	outcome(b, true)
+	outcome(b, true)
+
+	want := "api:closed->open api:open->half-open api:half-open->closed"
+	if got := strings.Join(changes, " "); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestTransportPerHost(t *testing.T) {
+	var hits atomic.Int64
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	client := &http.Client{Transport: &Transport{Settings: settings(newFakeClock())}}
+	get := func(url string) (*http.Response, error) {
+		response, err := client.Get(url)
+		if err == nil {
+			response.Body.Close()
+		}
+		return response, err
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := get(bad.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := get(bad.URL)
+	var open *OpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrOpen) {
+		t.Fatalf("got %v, want *OpenError", err)
+	}
+	if host := strings.TrimPrefix(bad.URL, "http://"); open.Host != host {
+		t.Fatalf("open error for %q, want %q", open.Host, host)
+	}
+	if n := hits.Load(); n != 4 {
+		t.Fatalf("server saw %d requests, want 4", n)
+	}
+
+	// another host is unaffected
+	if response, err := get(good.URL); err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("good host: %v %v", response, err)
+	}
+}
+
+func TestBreakerDefaults(t *testing.T) {
+	// a zero Window used to divide by zero on the first outcome
+	for _, s := range []Settings{{}, {Window: 5, Buckets: 10}, {FailureRate: 2, MinRequests: -1}} {
+		b := NewBreaker("test", s)
+		if err := outcome(b, false); err != errFail {
+			t.Fatalf("%+v: got %v", s, err)
+		}
+		if b.State() != Closed {
+			t.Fatalf("%+v: a single failure opened the breaker", s)
+		}
+	}
+
+	// a zero value Transport works
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	response, err := (&http.Client{Transport: &Transport{}}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
+
+func TestCallerCancellationIsNotAFailure(t *testing.T) {
+	clock := newFakeClock()
+	b := NewBreaker("test", settings(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	}
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v after cancelled calls, want closed", s)
+	}
+
+	// a cancelled probe gives its slot back
+	for i := 0; i < 4; i++ {
+		outcome(b, false)
+	}
+	clock.Advance(5 * time.Second)
+	b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	if s := b.State(); s != HalfOpen {
+		t.Fatalf("state %v after a cancelled probe, want half-open", s)
+	}
+	outcome(b, true)
+	outcome(b, true)
+	if s := b.State(); s != Closed {
+		t.Fatalf("state %v after two probes, want closed", s)
+	}
+}
+
+func TestTransportCallerTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	transport := &Transport{Settings: settings(newFakeClock())}
+	client := &http.Client{Transport: transport}
+	for i := 0; i < 6; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, slow.URL, nil)
+		_, err := client.Do(req)
+		cancel()
+		if errors.Is(err, ErrOpen) {
+			t.Fatalf("request %d: caller timeouts opened the breaker", i)
+		}
+	}
+	if s := transport.breaker(strings.TrimPrefix(slow.URL, "http://")).State(); s != Closed {
+		t.Fatalf("state %v, want closed", s)
+	}
+}
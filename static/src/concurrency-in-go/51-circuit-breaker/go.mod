@@ -0,0 +1,3 @@
+module m51
+
+go 1.22.5
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+type Result struct {
+	Err      error
+	Response *http.Response
+}
+
+func fetchAll(done <-chan interface{}, client *http.Client, urls ...string) <-chan Result {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		for _, url := range urls {
+			var result Result
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err == nil {
+				result.Response, result.Err = client.Do(req)
+			} else {
+				result.Err = err
+			}
+			select {
+			case <-done:
+				if result.Response != nil {
+					result.Response.Body.Close()
+				}
+				return
+			case results <- result:
+			}
+		}
+	}()
+
+	return results
+}
+
+func main() {
+	// the server fails every request for its first 300ms, then recovers
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}))
+	defer server.Close()
+	time.AfterFunc(300*time.Millisecond, func() { healthy.Store(true) })
+
+	start := time.Now()
+	client := &http.Client{Transport: &Transport{Settings: Settings{
+		Window:      time.Second,
+		Buckets:     10,
+		MinRequests: 3,
+		FailureRate: 0.5,
+		OpenTimeout: 100 * time.Millisecond,
+		Probes:      2,
+		OnStateChange: func(host string, from, to State) {
+			fmt.Printf("%6v %s: %v -> %v\n", time.Since(start).Round(time.Millisecond), host, from, to)
+		},
+	}}}
+
+	done := make(chan interface{})
+	defer close(done)
+
+	// badhost never answers, but its breaker is separate from the server's
+	var urls []string
+	for i := 0; i < 5; i++ {
+		urls = append(urls, "http://badhost.invalid", server.URL)
+	}
+
+	for round := 0; round < 8; round++ {
+		var ok, failed, rejected int
+		for r := range fetchAll(done, client, urls...) {
+			switch {
+			case errors.Is(r.Err, ErrOpen):
+				rejected++
+			case r.Err != nil:
+				failed++
+			case r.Response.StatusCode >= 500:
+				r.Response.Body.Close()
+				failed++
+			default:
+				r.Response.Body.Close()
+				ok++
+			}
+		}
+		fmt.Printf("%6v round %d: ok=%d failed=%d rejected=%d\n", time.Since(start).Round(time.Millisecond), round, ok, failed, rejected)
+		time.Sleep(60 * time.Millisecond)
+	}
+}
@@ -0,0 +1,3 @@
+module m52
+
+go 1.22.5
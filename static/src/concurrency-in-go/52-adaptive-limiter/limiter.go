@@ -0,0 +1,265 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// a fixed concurrency limit is a guess: set too low it leaves the upstream idle, set too high it piles requests into the upstream's queues until they time out; an adaptive limiter instead learns the limit from how the upstream responds
+
+// every completed request reports its round trip time and whether it was dropped (an error, a 5xx or a 429); the algorithm turns that into a new limit, and requests beyond the limit wait in FIFO order for a slot
+
+// AIMD behaves like tcp congestion control: the limit grows by one for every limit's worth of successful requests and is cut by a factor on a drop, so it saws around the point where the upstream starts refusing work
+
+// the gradient algorithm looks at latency rather than errors, in the spirit of tcp vegas: it compares each sample with the round trip of an unloaded upstream, and once requests take noticeably longer than usual a queue is building upstream and the limit shrinks before anything fails
+
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Dropped
+	Ignored // the request says nothing about the upstream, e.g. it was cancelled by the caller
+)
+
+// Algorithm computes a new limit from a completed request
+type Algorithm interface {
+	Update(limit float64, rtt time.Duration, inFlight int, dropped bool) float64
+}
+
+type AIMD struct {
+	Backoff float64       // factor applied to the limit on a drop, e.g. 0.9
+	Timeout time.Duration // round trips slower than this count as drops; zero disables
+}
+
+func (a *AIMD) Update(limit float64, rtt time.Duration, inFlight int, dropped bool) float64 {
+	if dropped || (a.Timeout > 0 && rtt > a.Timeout) {
+		return limit * a.Backoff
+	}
+	// don't grow the limit while we are not even using it
+	if float64(inFlight) >= limit/2 {
+		return limit + 1/limit
+	}
+	return limit
+}
+
+type Gradient struct {
+	Tolerance float64 // how much slower than usual a round trip may be before the limit shrinks, e.g. 1.2
+
+	mu       sync.Mutex
+	baseline float64 // round trip of an unloaded upstream, in nanoseconds
+}
+
+func (g *Gradient) Update(limit float64, rtt time.Duration, inFlight int, dropped bool) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// the baseline follows a faster round trip at once but a slower one only very slowly, so that a queue building upstream shows up as a growing gap rather than being absorbed into the baseline
+	// a rejected request returns quickly and would drag the baseline down
+	sample := float64(rtt)
+	switch {
+	case dropped:
+	case g.baseline == 0 || sample < g.baseline:
+		g.baseline = sample
+	default:
+		g.baseline += (sample - g.baseline) / 10000
+	}
+
+	gradient := math.Max(0.5, math.Min(1, g.Tolerance*g.baseline/sample))
+	if dropped {
+		gradient = 0.5
+	}
+	if gradient == 1 && float64(inFlight) < limit/2 {
+		return limit
+	}
+
+	// the square root leaves room for a small queue so the upstream is never starved; a limit's worth of requests completes every round trip, so each one moves the limit by a share of the step
+	next := limit*gradient + math.Sqrt(limit)
+	return limit + (next-limit)/limit
+}
+
+type waiter struct {
+	ready chan struct{}
+}
+
+type Limiter struct {
+	Min, Max int
+
+	// OnLimitChange is called with the lock held whenever the integer limit changes
+	OnLimitChange func(limit int)
+
+	algorithm Algorithm
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  list.List // *waiter, oldest first
+}
+
+// NewLimiter starts at initial clamped to the default bounds of [1, 1000]; a limit below one would never admit a request
+func NewLimiter(initial int, algorithm Algorithm) *Limiter {
+	l := &Limiter{Min: 1, Max: 1000, algorithm: algorithm}
+	l.limit = float64(max(l.Min, min(l.Max, initial)))
+	return l
+}
+
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire waits for a slot; release must be called exactly once with the outcome of the request
+func (l *Limiter) Acquire(ctx context.Context) (release func(Outcome), err error) {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.waiters.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	e := l.waiters.PushBack(w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(), nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// granted at the same time as the context was cancelled
+		return l.releaser(), nil
+	default:
+	}
+	l.waiters.Remove(e)
+	return nil, ctx.Err()
+}
+
+func (l *Limiter) releaser() func(Outcome) {
+	start := time.Now()
+	var once sync.Once
+	return func(o Outcome) {
+		once.Do(func() { l.release(time.Since(start), o) })
+	}
+}
+
+func (l *Limiter) release(rtt time.Duration, o Outcome) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the sample includes ourselves, as the algorithm wants to know how busy we were while the request ran
+	if o != Ignored {
+		before := int(l.limit)
+		l.limit = l.algorithm.Update(l.limit, rtt, l.inFlight, o == Dropped)
+		l.limit = math.Max(float64(l.Min), math.Min(float64(l.Max), l.limit))
+		if int(l.limit) != before && l.OnLimitChange != nil {
+			l.OnLimitChange(int(l.limit))
+		}
+	}
+	l.inFlight--
+
+	for l.inFlight < int(l.limit) {
+		e := l.waiters.Front()
+		if e == nil {
+			break
+		}
+		l.waiters.Remove(e)
+		l.inFlight++
+		close(e.Value.(*waiter).ready)
+	}
+}
+
+// Result is the output of a stage
+type Result[R any] struct {
+	Value R
+	Err   error
+}
+
+// Stage applies fn to every value from in with as much concurrency as the limiter allows; results are delivered in completion order
+func Stage[T, R any](ctx context.Context, l *Limiter, in <-chan T, fn func(context.Context, T) (R, error)) <-chan Result[R] {
+	out := make(chan Result[R])
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(out)
+		}()
+
+		for v := range in {
+			release, err := l.Acquire(ctx)
+			if err != nil {
+				return
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r, err := fn(ctx, v)
+				switch {
+				case err == nil:
+					release(Success)
+				case ctx.Err() != nil:
+					release(Ignored)
+				default:
+					release(Dropped)
+				}
+
+				select {
+				case <-ctx.Done():
+				case out <- Result[R]{Value: r, Err: err}:
+				}
+			}()
+		}
+	}()
+
+	return out
+}
+
+// Transport limits the requests in flight through it; transport errors, 5xx and 429 responses count as drops
+type Transport struct {
+	Transport http.RoundTripper
+	Limiter   *Limiter
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	release, err := t.Limiter.Acquire(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	response, err := transport.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		release(Ignored)
+	case err != nil, response.StatusCode >= 500, response.StatusCode == http.StatusTooManyRequests:
+		release(Dropped)
+	default:
+		release(Success)
+	}
+	return response, err
+}
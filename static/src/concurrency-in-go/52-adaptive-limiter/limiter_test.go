@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fixed never changes the limit
+type fixed struct{}
+
+func (fixed) Update(limit float64, rtt time.Duration, inFlight int, dropped bool) float64 {
+	return limit
+}
+
+func TestLimiterBlocksAtLimit(t *testing.T) {
+	l := NewLimiter(2, fixed{})
+
+	release1, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+
+	// waiters are granted slots in the order they arrived
+	order := make(chan int, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			release(Ignored)
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	release1(Success)
+	release1(Success) // releasing twice has no effect
+	wg.Wait()
+
+	if first, second := <-order, <-order; first != 0 || second != 1 {
+		t.Fatalf("waiters served in order %d, %d", first, second)
+	}
+	if n := l.InFlight(); n != 1 {
+		t.Fatalf("%d in flight, want 1", n)
+	}
+}
+
+func TestNewLimiterClampsInitial(t *testing.T) {
+	for _, tc := range []struct{ initial, want int }{
+		{-5, 1},
+		{0, 1},
+		{50, 50},
+		{1 << 40, 1000},
+	} {
+		l := NewLimiter(tc.initial, fixed{})
+		if got := l.Limit(); got != tc.want {
+			t.Errorf("NewLimiter(%d): limit %d, want %d", tc.initial, got, tc.want)
+		}
+	}
+
+	// a zero initial limit must still admit a request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := NewLimiter(0, fixed{}).Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(Success)
+}
+
+func TestAIMD(t *testing.T) {
+	a := &AIMD{Backoff: 0.5, Timeout: 100 * time.Millisecond}
+
+	if got := a.Update(10, time.Millisecond, 10, false); got <= 10 {
+		t.Errorf("success: limit %v, want more than 10", got)
+	}
+	if got := a.Update(10, time.Millisecond, 2, false); got != 10 {
+		t.Errorf("success while underused: limit %v, want 10", got)
+	}
+	if got := a.Update(10, time.Millisecond, 10, true); got != 5 {
+		t.Errorf("drop: limit %v, want 5", got)
+	}
+	if got := a.Update(10, time.Second, 10, false); got != 5 {
+		t.Errorf("timeout: limit %v, want 5", got)
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g := &Gradient{Tolerance: 1.2}
+
+	limit := 10.0
+	for i := 0; i < 50; i++ {
+		limit = g.Update(limit, 10*time.Millisecond, int(limit), false)
+	}
+	if limit <= 10 {
+		t.Fatalf("limit %v did not grow while latency was steady", limit)
+	}
+
+	grown := limit
+	for i := 0; i < 50; i++ {
+		limit = g.Update(limit, 30*time.Millisecond, int(limit), false)
+	}
+	if limit >= grown {
+		t.Fatalf("limit %v did not shrink from %v while latency tripled", limit, grown)
+	}
+
+	// a fast rejection says nothing about the latency of a healthy upstream
+	baseline := g.baseline
+	g.Update(limit, time.Microsecond, int(limit), true)
+	if g.baseline != baseline {
+		t.Fatalf("baseline %v moved on a dropped request", time.Duration(g.baseline))
+	}
+}
+
+// load sends n requests from many goroutines through a limited client and returns the number of failed requests
+func load(t *testing.T, l *Limiter, url string, n int) int {
+	t.Helper()
+	client := &http.Client{Transport: &Transport{
+		Limiter:   l,
+		Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+	}}
+
+	var failed, next atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1); i <= int64(n); i = next.Add(1) {
+				response, err := client.Get(fmt.Sprintf("%s/%d", url, i))
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+				if response.StatusCode != http.StatusOK {
+					failed.Add(1)
+				}
+				response.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	return int(failed.Load())
+}
+
+func TestLimiterConverges(t *testing.T) {
+	const capacity = 10
+
+	for _, tc := range []struct {
+		name      string
+		algorithm Algorithm
+	}{
+		{"aimd", &AIMD{Backoff: 0.9, Timeout: 50 * time.Millisecond}},
+		{"gradient", &Gradient{Tolerance: 1.2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, rejected := newCapacityServer(capacity, 5*time.Millisecond)
+			defer server.Close()
+
+			l := NewLimiter(1, tc.algorithm)
+			failed := load(t, l, server.URL, 2000)
+
+			// the limit settles between the capacity of the upstream and the point where it starts rejecting
+			if limit := l.Limit(); limit < capacity/2 || limit > 2*capacity+2 {
+				t.Errorf("limit %d, upstream capacity %d", limit, capacity)
+			}
+			if failed > 100 || rejected.Load() > 100 {
+				t.Errorf("%d requests failed, %d rejected upstream", failed, rejected.Load())
+			}
+		})
+	}
+}
+
+func TestLimiterUnlimitedOverloads(t *testing.T) {
+	// without adapting, the same load overwhelms the upstream
+	server, rejected := newCapacityServer(10, 5*time.Millisecond)
+	defer server.Close()
+
+	load(t, NewLimiter(100, fixed{}), server.URL, 2000)
+	if rejected.Load() < 100 {
+		t.Fatalf("only %d requests rejected without adaptive limit", rejected.Load())
+	}
+}
+
+func TestStage(t *testing.T) {
+	l := NewLimiter(4, fixed{})
+
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 50; i++ {
+			in <- i
+		}
+	}()
+
+	var inFlight, peak atomic.Int64
+	results := Stage(context.Background(), l, in, func(ctx context.Context, v int) (int, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		if v%10 == 0 {
+			return 0, errors.New("failed")
+		}
+		return v * v, nil
+	})
+
+	var sum, errCount int
+	for r := range results {
+		if r.Err != nil {
+			errCount++
+			continue
+		}
+		sum += r.Value
+	}
+
+	if errCount != 5 {
+		t.Errorf("%d errors, want 5", errCount)
+	}
+	if want := 40425 - 3000; sum != want {
+		t.Errorf("sum %d, want %d", sum, want)
+	}
+	if p := peak.Load(); p > 4 {
+		t.Errorf("peak concurrency %d exceeds limit 4", p)
+	}
+}
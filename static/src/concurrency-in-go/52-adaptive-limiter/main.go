@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// newCapacityServer simulates an upstream that serves capacity requests at once in the given latency; beyond that requests share the server and slow down, and beyond twice the capacity they are rejected with a 503
+func newCapacityServer(capacity int, latency time.Duration) (*httptest.Server, *atomic.Int64) {
+	var inFlight, rejected atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		if n > int64(2*capacity) {
+			rejected.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(latency * time.Duration(max(n, int64(capacity))) / time.Duration(capacity))
+		fmt.Fprintln(w, "ok")
+	}))
+	return server, &rejected
+}
+
+func fetchAll(done <-chan interface{}, l *Limiter, urls ...string) <-chan Result[*http.Response] {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	generator := make(chan string)
+	go func() {
+		defer close(generator)
+		for _, url := range urls {
+			select {
+			case <-ctx.Done():
+				return
+			case generator <- url:
+			}
+		}
+	}()
+
+	return Stage(ctx, l, generator, func(ctx context.Context, url string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := http.DefaultClient.Do(req)
+		if err == nil && response.StatusCode >= 500 {
+			response.Body.Close()
+			return nil, fmt.Errorf("%s: %s", url, response.Status)
+		}
+		return response, err
+	})
+}
+
+// plot samples the limit of l until done is closed and prints it as a bar chart
+func plot(done <-chan interface{}, l *Limiter, every time.Duration) <-chan interface{} {
+	finished := make(chan interface{})
+	go func() {
+		defer close(finished)
+		start := time.Now()
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				limit := l.Limit()
+				fmt.Printf("%6v %3d %s\n", time.Since(start).Round(10*time.Millisecond), limit, strings.Repeat("#", limit))
+			}
+		}
+	}()
+	return finished
+}
+
+func main() {
+	const capacity = 20
+	server, rejected := newCapacityServer(capacity, 10*time.Millisecond)
+	defer server.Close()
+
+	urls := make([]string, 3000)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/%d", server.URL, i)
+	}
+
+	fmt.Printf("upstream capacity %d\n\nAIMD as a pipeline stage\n", capacity)
+	aimd := NewLimiter(1, &AIMD{Backoff: 0.9, Timeout: 50 * time.Millisecond})
+
+	done := make(chan interface{})
+	plotted := plot(done, aimd, 100*time.Millisecond)
+	errCount := 0
+	for r := range fetchAll(done, aimd, urls...) {
+		if r.Err != nil {
+			errCount++
+			continue
+		}
+		r.Value.Body.Close()
+	}
+	close(done)
+	<-plotted
+	fmt.Printf("errors: %d, rejected upstream: %d\n", errCount, rejected.Swap(0))
+
+	fmt.Println("\ngradient as a RoundTripper")
+	gradient := NewLimiter(1, &Gradient{Tolerance: 1.2})
+	client := &http.Client{Transport: &Transport{
+		Limiter:   gradient,
+		Transport: &http.Transport{MaxIdleConnsPerHost: 100},
+	}}
+
+	done = make(chan interface{})
+	plotted = plot(done, gradient, 100*time.Millisecond)
+
+	// far more callers than the upstream can serve, all going through the same client
+	var wg sync.WaitGroup
+	var next atomic.Int64
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := next.Add(1); n <= int64(len(urls)); n = next.Add(1) {
+				response, err := client.Get(urls[n-1])
+				if err == nil {
+					response.Body.Close()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-plotted
+	fmt.Printf("rejected upstream: %d\n", rejected.Load())
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a caching transport answers repeated requests for the same url from a local copy of the response; while the copy is fresh it is returned without touching the network at all, and once it goes stale it is revalidated with a conditional request which costs a round trip but not the body when the server answers 304 Not Modified
+
+// with stale-while-revalidate the server allows a stale copy to be returned straight away while a single background request refreshes it, so callers never wait on revalidation within that window
+
+// only GET requests are cached; other methods go straight to the network, and a successful unsafe request invalidates what was cached for its url
+
+type Status int
+
+const (
+	Miss        Status = iota // fetched from the network
+	Hit                       // fresh copy from the cache
+	Stale                     // stale copy from the cache, revalidated in the background
+	Revalidated               // copy from the cache confirmed by the server with a 304
+)
+
+func (s Status) String() string {
+	switch s {
+	case Hit:
+		return "HIT"
+	case Stale:
+		return "STALE"
+	case Revalidated:
+		return "REVALIDATED"
+	}
+	return "MISS"
+}
+
+const (
+	statusHeader = "X-Cache"
+	storedHeader = "X-Cache-Stored" // time the response was stored, kept with the serialized response
+)
+
+// CacheStatus reports how a response passing through a Transport was served
+func CacheStatus(response *http.Response) Status {
+	switch response.Header.Get(statusHeader) {
+	case "HIT":
+		return Hit
+	case "STALE":
+		return Stale
+	case "REVALIDATED":
+		return Revalidated
+	}
+	return Miss
+}
+
+type Transport struct {
+	Transport http.RoundTripper
+	Storage   Storage
+	Now       func() time.Time // replaced in tests
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+	background   sync.WaitGroup
+}
+
+func NewTransport(storage Storage) *Transport {
+	return &Transport{Storage: storage}
+}
+
+func (t *Transport) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+	return t.Now()
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if k != "" {
+				cc[strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a directive such as max-age
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// lifetime is how long a response stays fresh after it was generated
+func lifetime(h http.Header, stored time.Time) time.Duration {
+	if maxAge, ok := parseCacheControl(h).seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = stored
+	}
+	if expires := h.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// an invalid date such as "0" means already expired
+			return 0
+		}
+		return max(t.Sub(date), 0)
+	}
+
+	// without explicit freshness, a document that hasn't changed in a long time is unlikely to change soon
+	if lastModified, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		return max(date.Sub(lastModified)/10, 0)
+	}
+	return 0
+}
+
+// age is how long ago the server generated the response
+func age(h http.Header, stored, now time.Time) time.Duration {
+	a := now.Sub(stored)
+	if seconds, err := strconv.Atoi(h.Get("Age")); err == nil && seconds > 0 {
+		a += time.Duration(seconds) * time.Second
+	}
+	return max(a, 0)
+}
+
+func cacheable(response *http.Response, now time.Time) bool {
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return false
+	}
+	if parseCacheControl(response.Header).has("no-store") {
+		return false
+	}
+	// we don't keep separate copies per request header
+	for _, vary := range response.Header.Values("Vary") {
+		if !strings.EqualFold(strings.TrimSpace(vary), "Accept-Encoding") {
+			return false
+		}
+	}
+
+	// a response that is never fresh and cannot be revalidated is of no use
+	h := response.Header
+	return lifetime(h, now) > 0 || h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+func key(req *http.Request) string {
+	return req.URL.String()
+}
+
+// load returns the cached response for req along with the time it was stored
+func (t *Transport) load(req *http.Request) (*http.Response, time.Time, bool) {
+	data, ok := t.Storage.Get(key(req))
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		t.Storage.Delete(key(req))
+		return nil, time.Time{}, false
+	}
+	stored, err := time.Parse(time.RFC3339Nano, response.Header.Get(storedHeader))
+	if err != nil {
+		t.Storage.Delete(key(req))
+		return nil, time.Time{}, false
+	}
+	response.Header.Del(storedHeader)
+	return response, stored, true
+}
+
+// store reads the body of response so that it can be kept, returning a response that can still be read by the caller
+func (t *Transport) store(req *http.Request, response *http.Response) (*http.Response, error) {
+	// a response that will not be cached is passed on as it is, however large its body
+	if !cacheable(response, t.now()) {
+		return response, nil
+	}
+
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	response.ContentLength = int64(len(body))
+	response.TransferEncoding = nil
+
+	copied := *response
+	copied.Header = response.Header.Clone()
+	copied.Header.Set(storedHeader, t.now().Format(time.RFC3339Nano))
+	copied.Header.Del(statusHeader)
+	copied.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := httputil.DumpResponse(&copied, true)
+	if err == nil {
+		t.Storage.Set(key(req), data)
+	}
+	return response, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		response, err := t.transport().RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && response.StatusCode < 400 {
+			t.Storage.Delete(key(req))
+		}
+		return response, err
+	}
+
+	// the caller is doing its own revalidation, or doesn't want its response stored
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+
+	cached, stored, ok := t.load(req)
+	if !ok {
+		response, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return t.miss(req, response)
+	}
+
+	now := t.now()
+	respCC := parseCacheControl(cached.Header)
+	a := age(cached.Header, stored, now)
+	fresh := a < lifetime(cached.Header, stored)
+	if maxAge, ok := reqCC.seconds("max-age"); ok && a > maxAge {
+		fresh = false
+	}
+	mustRevalidate := reqCC.has("no-cache") || respCC.has("no-cache")
+
+	if fresh && !mustRevalidate {
+		return serve(cached, Hit, a), nil
+	}
+
+	swr, ok := respCC.seconds("stale-while-revalidate")
+	if ok && !mustRevalidate && !respCC.has("must-revalidate") && a < lifetime(cached.Header, stored)+swr {
+		t.revalidateInBackground(req)
+		return serve(cached, Stale, a), nil
+	}
+
+	cached.Body.Close()
+	return t.revalidate(req)
+}
+
+func (t *Transport) miss(req *http.Request, response *http.Response) (*http.Response, error) {
+	response, err := t.store(req, response)
+	if err != nil {
+		return nil, err
+	}
+	response.Header.Set(statusHeader, Miss.String())
+	return response, nil
+}
+
+func serve(response *http.Response, status Status, age time.Duration) *http.Response {
+	response.Header.Set(statusHeader, status.String())
+	response.Header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	return response
+}
+
+// revalidate asks the server whether the cached copy for req is still current
+func (t *Transport) revalidate(req *http.Request) (*http.Response, error) {
+	cached, _, ok := t.load(req)
+	if !ok {
+		response, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		return t.miss(req, response)
+	}
+
+	conditional := req.Clone(req.Context())
+	if etag := cached.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	response, err := t.transport().RoundTrip(conditional)
+	if err != nil {
+		cached.Body.Close()
+		return nil, err
+	}
+	if response.StatusCode != http.StatusNotModified {
+		cached.Body.Close()
+		response.Request = req
+		return t.miss(req, response)
+	}
+	response.Body.Close()
+
+	// the 304 carries updated headers such as a new Date or Cache-Control; the stored copy starts a new life from now
+	for k, v := range response.Header {
+		if k != "Content-Length" {
+			cached.Header[k] = v
+		}
+	}
+	cached.Header.Del("Age")
+	updated, err := t.store(req, cached)
+	if err != nil {
+		return nil, err
+	}
+	return serve(updated, Revalidated, 0), nil
+}
+
+// revalidateInBackground refreshes the cached copy for req unless that is already under way
+func (t *Transport) revalidateInBackground(req *http.Request) {
+	k := key(req)
+
+	t.mu.Lock()
+	if t.revalidating[k] {
+		t.mu.Unlock()
+		return
+	}
+	if t.revalidating == nil {
+		t.revalidating = make(map[string]bool)
+	}
+	t.revalidating[k] = true
+	t.mu.Unlock()
+
+	// the refresh must not be cancelled when the caller that triggered it is done
+	req = req.Clone(context.WithoutCancel(req.Context()))
+
+	t.background.Add(1)
+	go func() {
+		defer t.background.Done()
+		defer func() {
+			t.mu.Lock()
+			delete(t.revalidating, k)
+			t.mu.Unlock()
+		}()
+
+		response, err := t.revalidate(req)
+		if err == nil {
+			response.Body.Close()
+		}
+	}()
+}
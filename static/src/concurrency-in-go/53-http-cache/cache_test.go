@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// origin serves every path with the given headers and counts the requests and the 304s it sent
+type origin struct {
+	*httptest.Server
+	requests, notModified atomic.Int64
+	body                  atomic.Value // string
+}
+
+func newOrigin(t *testing.T, headers map[string]string) *origin {
+	o := &origin{}
+	o.body.Store("v1")
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.requests.Add(1)
+		body := o.body.Load().(string)
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		if _, ok := headers["ETag"]; ok {
+			w.Header().Set("ETag", `"`+body+`"`)
+			if r.Header.Get("If-None-Match") == `"`+body+`"` {
+				o.notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		if lm, ok := headers["Last-Modified"]; ok && r.Header.Get("If-Modified-Since") == lm {
+			o.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(o.Close)
+	return o
+}
+
+func newClient(storage Storage) (*http.Client, *Transport, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	transport := NewTransport(storage)
+	transport.Now = clock.Now
+	return &http.Client{Transport: transport}, transport, clock
+}
+
+func get(t *testing.T, client *http.Client, url string) (string, Status) {
+	t.Helper()
+	response, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), CacheStatus(response)
+}
+
+func expect(t *testing.T, client *http.Client, url string, wantBody string, wantStatus Status) {
+	t.Helper()
+	body, status := get(t, client, url)
+	if body != wantBody || status != wantStatus {
+		t.Fatalf("got %q %v, want %q %v", body, status, wantBody, wantStatus)
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=60"})
+	client, _, clock := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	o.body.Store("v2")
+	clock.Advance(59 * time.Second)
+	expect(t, client, o.URL, "v1", Hit)
+
+	clock.Advance(2 * time.Second)
+	expect(t, client, o.URL, "v2", Miss)
+	if n := o.requests.Load(); n != 2 {
+		t.Fatalf("origin saw %d requests, want 2", n)
+	}
+}
+
+func TestExpires(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Expires": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)})
+	client, _, _ := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	expect(t, client, o.URL, "v1", Hit)
+}
+
+func TestNoStore(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "no-store"})
+	client, _, _ := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	expect(t, client, o.URL, "v1", Miss)
+}
+
+func TestUncacheableIsNotBuffered(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, "first")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, " second")
+	}))
+	defer server.Close()
+	defer close(release)
+
+	// the response arrives before the body is complete
+	client, _, _ := newClient(NewMemoryStorage(1 << 20))
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	buf := make([]byte, len("first"))
+	if _, err := io.ReadFull(response.Body, buf); err != nil || string(buf) != "first" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+}
+
+func TestETagRevalidation(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "no-cache", "ETag": ""})
+	client, _, _ := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	expect(t, client, o.URL, "v1", Revalidated)
+	if n := o.notModified.Load(); n != 1 {
+		t.Fatalf("origin sent %d 304s, want 1", n)
+	}
+
+	o.body.Store("v2")
+	expect(t, client, o.URL, "v2", Miss)
+	expect(t, client, o.URL, "v2", Revalidated)
+}
+
+func TestLastModifiedRevalidation(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=10", "Last-Modified": lastModified})
+	client, _, clock := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	clock.Advance(11 * time.Second)
+	expect(t, client, o.URL, "v1", Revalidated)
+
+	// revalidation made the copy fresh again
+	expect(t, client, o.URL, "v1", Hit)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=30"})
+	client, transport, clock := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	o.body.Store("v2")
+
+	// the stale copy is served immediately while the new one is fetched in the background
+	clock.Advance(20 * time.Second)
+	expect(t, client, o.URL, "v1", Stale)
+	transport.background.Wait()
+	expect(t, client, o.URL, "v2", Hit)
+
+	// past the window the caller has to wait for the origin
+	o.body.Store("v3")
+	clock.Advance(time.Minute)
+	expect(t, client, o.URL, "v3", Miss)
+}
+
+func TestZeroTransport(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=10, stale-while-revalidate=30"})
+	clock := &fakeClock{now: time.Now()}
+	transport := &Transport{Storage: NewMemoryStorage(1 << 20), Now: clock.Now}
+	client := &http.Client{Transport: transport}
+
+	expect(t, client, o.URL, "v1", Miss)
+	clock.Advance(20 * time.Second)
+	expect(t, client, o.URL, "v1", Stale)
+	transport.background.Wait()
+}
+
+func TestStaleWhileRevalidateOnce(t *testing.T) {
+	release := make(chan struct{})
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	client, transport, clock := newClient(NewMemoryStorage(1 << 20))
+	expect(t, client, server.URL, "ok", Miss)
+	clock.Advance(2 * time.Second)
+
+	for i := 0; i < 10; i++ {
+		expect(t, client, server.URL, "ok", Stale)
+	}
+	close(release)
+	transport.background.Wait()
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("origin saw %d requests, want 2", n)
+	}
+}
+
+func TestUnsafeMethodInvalidates(t *testing.T) {
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=60"})
+	client, _, _ := newClient(NewMemoryStorage(1 << 20))
+
+	expect(t, client, o.URL, "v1", Miss)
+	o.body.Store("v2")
+	response, err := client.Post(o.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	expect(t, client, o.URL, "v2", Miss)
+}
+
+func TestStorageEviction(t *testing.T) {
+	disk, err := NewDiskStorage(t.TempDir(), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, s := range map[string]Storage{"memory": NewMemoryStorage(30), "disk": disk} {
+		t.Run(name, func(t *testing.T) {
+			s.Set("a", make([]byte, 10))
+			s.Set("b", make([]byte, 10))
+			s.Set("c", make([]byte, 10))
+			s.Get("a") // a is now used more recently than b
+
+			s.Set("d", make([]byte, 10))
+			if _, ok := s.Get("b"); ok {
+				t.Fatal("least recently used entry was not evicted")
+			}
+			for _, k := range []string{"a", "c", "d"} {
+				if v, ok := s.Get(k); !ok || len(v) != 10 {
+					t.Fatalf("entry %s missing", k)
+				}
+			}
+
+			s.Delete("a")
+			if _, ok := s.Get("a"); ok {
+				t.Fatal("deleted entry still present")
+			}
+		})
+	}
+}
+
+func TestDiskStorageReopen(t *testing.T) {
+	dir := t.TempDir()
+	o := newOrigin(t, map[string]string{"Cache-Control": "max-age=60"})
+
+	disk, err := NewDiskStorage(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _, _ := newClient(disk)
+	expect(t, client, o.URL, "v1", Miss)
+
+	// a new process finds the responses stored by the previous one
+	disk, err = NewDiskStorage(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _, _ = newClient(disk)
+	expect(t, client, o.URL, "v1", Hit)
+}
@@ -0,0 +1,3 @@
+module m53
+
+go 1.22.5
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+type Result struct {
+	Err      error
+	Response *http.Response
+	Cache    Status
+}
+
+func fetchAll(done <-chan interface{}, client *http.Client, urls ...string) <-chan Result {
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		for _, url := range urls {
+			response, err := client.Get(url)
+			result := Result{Err: err, Response: response}
+			if err == nil {
+				result.Cache = CacheStatus(response)
+			}
+			select {
+			case <-done:
+				return
+			case results <- result:
+			}
+		}
+	}()
+
+	return results
+}
+
+func main() {
+	var requests atomic.Int64
+	version := time.Now().Format(time.RFC1123)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/static":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/news":
+			w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+			w.Header().Set("Last-Modified", version)
+			if r.Header.Get("If-Modified-Since") == version {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/private":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprintf(w, "body of %s\n", r.URL.Path)
+	}))
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "http-cache")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	urls := []string{server.URL + "/static", server.URL + "/etag", server.URL + "/news", server.URL + "/private"}
+
+	for _, name := range []string{"memory", "disk"} {
+		var storage Storage = NewMemoryStorage(1 << 20)
+		if name == "disk" {
+			storage, err = NewDiskStorage(filepath.Join(dir, "responses"), 1<<20)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+		}
+		client := &http.Client{Transport: NewTransport(storage)}
+		requests.Store(0)
+
+		fmt.Printf("%s storage\n", name)
+		done := make(chan interface{})
+		for run := 1; run <= 3; run++ {
+			for r := range fetchAll(done, client, urls...) {
+				if r.Err != nil {
+					fmt.Printf("error: %v\n", r.Err)
+					continue
+				}
+				r.Response.Body.Close()
+				fmt.Printf("  run %d %-40s %v\n", run, r.Response.Request.URL, r.Cache)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(done)
+		fmt.Printf("  %d requests reached the server for %d fetches\n\n", requests.Load(), 3*len(urls))
+	}
+}
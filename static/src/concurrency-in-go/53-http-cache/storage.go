@@ -0,0 +1,206 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Storage holds serialized responses; implementations must be safe for concurrent use
+type Storage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+type lruEntry struct {
+	key   string
+	size  int64
+	value []byte // nil for entries kept on disk
+}
+
+// lru keeps entries in order of use and tracks their total size; it is not safe for concurrent use
+type lru struct {
+	max   int64
+	size  int64
+	ll    list.List // *lruEntry, most recently used first
+	items map[string]*list.Element
+}
+
+func newLRU(max int64) *lru {
+	return &lru{max: max, items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(key string) (*lruEntry, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry), true
+}
+
+// add inserts or replaces an entry and returns the keys evicted to make room for it
+func (c *lru) add(key string, size int64, value []byte) (evicted []string) {
+	c.remove(key)
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, size: size, value: value})
+	c.size += size
+
+	for c.size > c.max {
+		e := c.ll.Back()
+		entry := e.Value.(*lruEntry)
+		c.remove(entry.key)
+		evicted = append(evicted, entry.key)
+	}
+	return evicted
+}
+
+func (c *lru) remove(key string) bool {
+	e, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.ll.Remove(e)
+	delete(c.items, key)
+	c.size -= e.Value.(*lruEntry).size
+	return true
+}
+
+type MemoryStorage struct {
+	mu  sync.Mutex
+	lru *lru
+}
+
+// NewMemoryStorage keeps at most maxBytes of responses in memory
+func NewMemoryStorage(maxBytes int64) *MemoryStorage {
+	return &MemoryStorage{lru: newLRU(maxBytes)}
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lru.get(key)
+	if !ok {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (s *MemoryStorage) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lru.add(key, int64(len(value)), value)
+}
+
+func (s *MemoryStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lru.remove(key)
+}
+
+// DiskStorage keeps one file per response; the order of use survives restarts through the modification times of the files
+type DiskStorage struct {
+	dir string
+
+	mu  sync.Mutex
+	lru *lru // keyed by file name
+}
+
+func NewDiskStorage(dir string, maxBytes int64) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []os.FileInfo
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() && filepath.Ext(e.Name()) == "" {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	s := &DiskStorage{dir: dir, lru: newLRU(maxBytes)}
+	for _, info := range infos {
+		for _, name := range s.lru.add(info.Name(), info.Size(), nil) {
+			os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return s, nil
+}
+
+func (s *DiskStorage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *DiskStorage) Get(key string) ([]byte, bool) {
+	name := fileName(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lru.get(name); !ok {
+		return nil, false
+	}
+	value, err := os.ReadFile(s.path(name))
+	if err != nil {
+		s.lru.remove(name)
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(s.path(name), now, now)
+	return value, true
+}
+
+func (s *DiskStorage) Set(key string, value []byte) {
+	name := fileName(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// write to a temporary file first so a crash never leaves a truncated entry behind
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	for _, evicted := range s.lru.add(name, int64(len(value)), nil) {
+		os.Remove(s.path(evicted))
+	}
+}
+
+func (s *DiskStorage) Delete(key string) {
+	name := fileName(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lru.remove(name) {
+		os.Remove(s.path(name))
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the crawler is the fetchAll pattern turned into a loop: a pool of workers fetches links and sends back what it found, and a single coordinator goroutine owns the set of urls seen so far, so deduplication needs no locking
+
+// every link is checked, but only pages on the host of the root url are parsed for further links, and only down to the maximum depth; links to other hosts are checked without being crawled
+
+// the workers are polite: robots.txt is fetched once per host and obeyed, and requests to the same host are spaced out by the configured delay or the Crawl-delay of robots.txt, whichever is longer
+
+type Crawler struct {
+	Client      *http.Client
+	UserAgent   string
+	Concurrency int
+	Delay       time.Duration // minimum time between requests to the same host
+	MaxDepth    int           // links further than this from the root are not followed; zero means no limit
+	External    bool          // also check links to other hosts
+	MaxPageSize int64         // larger pages are not parsed; zero means 5 MiB
+}
+
+// Result reports a checked link; a link found broken is reported again for every further page it is found on
+type Result struct {
+	URL        string
+	Pages      []string // pages the link was found on so far; empty for the root
+	Depth      int
+	StatusCode int
+	Err        error
+	Disallowed bool // robots.txt kept us from checking the link
+}
+
+func (r Result) Broken() bool {
+	return !r.Disallowed && (r.Err != nil || r.StatusCode >= 400)
+}
+
+type link struct {
+	url   string
+	host  string
+	depth int
+	crawl bool // parse the page for further links
+}
+
+type page struct {
+	link
+	statusCode int
+	err        error
+	disallowed bool
+	links      []string
+}
+
+// host holds what we know about a host while crawling
+type host struct {
+	ready  chan struct{} // closed once robots.txt was fetched
+	robots *robots
+	token  chan struct{} // held while waiting for and making a request to the host
+	next   time.Time     // earliest time of the next request; guarded by token
+}
+
+type hosts struct {
+	mu    sync.Mutex
+	hosts map[string]*host
+}
+
+func (c *Crawler) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+func (c *Crawler) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return c.client().Do(req)
+}
+
+// host returns the state of the host of u, fetching its robots.txt on first use
+func (c *Crawler) host(ctx context.Context, hs *hosts, u *url.URL) (*host, error) {
+	hs.mu.Lock()
+	h, ok := hs.hosts[u.Host]
+	if !ok {
+		h = &host{ready: make(chan struct{}), robots: allowAll, token: make(chan struct{}, 1)}
+		hs.hosts[u.Host] = h
+	}
+	hs.mu.Unlock()
+
+	if !ok {
+		response, err := c.get(ctx, u.Scheme+"://"+u.Host+"/robots.txt")
+		if err == nil {
+			if response.StatusCode == http.StatusOK {
+				h.robots = parseRobots(io.LimitReader(response.Body, 512*1024), c.UserAgent)
+			}
+			response.Body.Close()
+		}
+		close(h.ready)
+	}
+
+	select {
+	case <-h.ready:
+		return h, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait blocks until a request to h may be made and returns a function to call once it was made
+
+// only one request to a host is under way at a time and the next one may start no earlier than the delay after it was answered, so a worker that is scheduled late cannot bunch its request up with the next
+func (c *Crawler) wait(ctx context.Context, h *host) (func(), error) {
+	delay := max(c.Delay, h.robots.crawlDelay)
+	if delay <= 0 {
+		return func() {}, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case h.token <- struct{}{}:
+	}
+
+	select {
+	case <-ctx.Done():
+		<-h.token
+		return nil, ctx.Err()
+	case <-time.After(time.Until(h.next)):
+	}
+
+	return func() {
+		h.next = time.Now().Add(delay)
+		<-h.token
+	}, nil
+}
+
+func (c *Crawler) fetch(ctx context.Context, hs *hosts, l link) page {
+	p := page{link: l}
+	u, err := url.Parse(l.url)
+	if err != nil {
+		p.err = err
+		return p
+	}
+
+	h, err := c.host(ctx, hs, u)
+	if err != nil {
+		p.err = err
+		return p
+	}
+	if !h.robots.allowed(u.EscapedPath()) {
+		p.disallowed = true
+		return p
+	}
+	done, err := c.wait(ctx, h)
+	if err != nil {
+		p.err = err
+		return p
+	}
+
+	response, err := c.get(ctx, l.url)
+	done()
+	if err != nil {
+		p.err = err
+		return p
+	}
+	defer response.Body.Close()
+	p.statusCode = response.StatusCode
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	// a redirect may have taken us to another host, which we don't crawl
+	if !l.crawl || response.StatusCode != http.StatusOK || mediaType != "text/html" || response.Request.URL.Host != l.host {
+		io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+		return p
+	}
+
+	maxPageSize := c.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = 5 << 20
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxPageSize))
+	if err != nil {
+		p.err = err
+		return p
+	}
+	p.links = extractLinks(response.Request.URL, string(body))
+	return p
+}
+
+// fetchAll fetches every link it receives with a fixed pool of workers
+func (c *Crawler) fetchAll(ctx context.Context, links <-chan link) <-chan page {
+	pages := make(chan page)
+	hs := &hosts{hosts: make(map[string]*host)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(c.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range links {
+				p := c.fetch(ctx, hs, l)
+				select {
+				case <-ctx.Done():
+					return
+				case pages <- p:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+
+	return pages
+}
+
+var (
+	commentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	linkPattern    = regexp.MustCompile(`(?is)<(a|area|link|img|script|iframe|source|base)\b[^>]*?\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// extractLinks returns the absolute, normalized urls linked from an html document
+func extractLinks(base *url.URL, document string) []string {
+	document = commentPattern.ReplaceAllString(document, "")
+
+	var links []string
+	for _, m := range linkPattern.FindAllStringSubmatch(document, -1) {
+		ref := html.UnescapeString(m[2] + m[3] + m[4])
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(m[1], "base") {
+			base = u
+			continue
+		}
+		if normalized, ok := normalize(u); ok {
+			links = append(links, normalized)
+		}
+	}
+	return links
+}
+
+// normalize makes equivalent urls compare equal, rejecting those we can't check such as mailto: links
+func normalize(u *url.URL) (string, bool) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	n := *u
+	n.Fragment = ""
+	n.RawFragment = ""
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); (n.Scheme == "http" && port == "80") || (n.Scheme == "https" && port == "443") {
+		n.Host = n.Hostname()
+	}
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	return n.String(), true
+}
+
+type entry struct {
+	pages  []string
+	result *Result // set once the link was checked
+}
+
+// Crawl checks root and everything reachable from it, reporting each link on the returned channel
+func (c *Crawler) Crawl(ctx context.Context, root string) <-chan Result {
+	results := make(chan Result)
+
+	u, err := url.Parse(root)
+	normalized, ok := "", false
+	if err == nil {
+		normalized, ok = normalize(u)
+	}
+	if !ok {
+		go func() {
+			defer close(results)
+			if err == nil {
+				err = errors.New("root must be an absolute http or https url")
+			}
+			select {
+			case <-ctx.Done():
+			case results <- Result{URL: root, Err: err}:
+			}
+		}()
+		return results
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	links := make(chan link)
+	pages := c.fetchAll(ctx, links)
+	u, _ = url.Parse(normalized)
+	rootHost := u.Host
+
+	go func() {
+		defer close(results)
+		defer cancel()
+		defer close(links)
+
+		seen := map[string]*entry{normalized: {}}
+		queue := []link{{url: normalized, host: rootHost, crawl: true}}
+		var outbox []Result
+		inFlight := 0
+
+		// found records a link from a page, queueing it if it is new
+		found := func(rawURL, from string, depth int) {
+			if e, ok := seen[rawURL]; ok {
+				if !slices.Contains(e.pages, from) {
+					e.pages = append(e.pages, from)
+					if e.result != nil && e.result.Broken() {
+						r := *e.result
+						r.Pages = []string{from}
+						outbox = append(outbox, r)
+					}
+				}
+				return
+			}
+
+			u, _ := url.Parse(rawURL)
+			sameHost := u.Host == rootHost
+			if !sameHost && !c.External {
+				return
+			}
+			seen[rawURL] = &entry{pages: []string{from}}
+			queue = append(queue, link{
+				url:   rawURL,
+				host:  u.Host,
+				depth: depth,
+				crawl: sameHost && (c.MaxDepth == 0 || depth < c.MaxDepth),
+			})
+		}
+
+		for len(queue) > 0 || inFlight > 0 || len(outbox) > 0 {
+			var next link
+			var out chan<- link
+			if len(queue) > 0 {
+				next, out = queue[0], links
+			}
+			var first Result
+			var send chan<- Result
+			if len(outbox) > 0 {
+				first, send = outbox[0], results
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- next:
+				queue = queue[1:]
+				inFlight++
+			case send <- first:
+				outbox = outbox[1:]
+			case p := <-pages:
+				inFlight--
+				e := seen[p.url]
+				e.result = &Result{
+					URL:        p.url,
+					Pages:      append([]string(nil), e.pages...),
+					Depth:      p.depth,
+					StatusCode: p.statusCode,
+					Err:        p.err,
+					Disallowed: p.disallowed,
+				}
+				outbox = append(outbox, *e.result)
+				for _, l := range p.links {
+					found(l, p.url, p.depth+1)
+				}
+			}
+		}
+	}()
+
+	return results
+}
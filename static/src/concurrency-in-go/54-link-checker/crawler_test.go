@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder wraps a handler and records the paths and times of the requests it served
+type recorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+	times    []time.Time
+}
+
+func newRecorder(t *testing.T, h http.Handler) *recorder {
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		r.requests = append(r.requests, req.URL.Path)
+		r.times = append(r.times, time.Now())
+		r.mu.Unlock()
+		h.ServeHTTP(w, req)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *recorder) served() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.requests)
+}
+
+// newSite serves the fixture site, with links to an external server that answers 410 for /gone
+func newSite(t *testing.T) (site, external *recorder) {
+	external = newRecorder(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	site = newRecorder(t, siteHandler("testdata/site", external.URL))
+	return site, external
+}
+
+// crawl returns the broken links as "url on page", with the urls relative to the fixture site, and the results by url
+func crawl(t *testing.T, c *Crawler, site, external *recorder) ([]string, map[string]Result) {
+	t.Helper()
+	relative := strings.NewReplacer(site.URL, "", external.URL, "EXTERNAL")
+
+	var broken []string
+	results := make(map[string]Result)
+	for r := range c.Crawl(context.Background(), site.URL) {
+		if _, ok := results[relative.Replace(r.URL)]; !ok {
+			results[relative.Replace(r.URL)] = r
+		}
+		if r.Broken() {
+			for _, page := range r.Pages {
+				broken = append(broken, relative.Replace(r.URL+" on "+page))
+			}
+		}
+	}
+	slices.Sort(broken)
+	return broken, results
+}
+
+func TestCrawl(t *testing.T) {
+	site, external := newSite(t)
+
+	c := &Crawler{Concurrency: 4, External: true}
+	broken, results := crawl(t, c, site, external)
+
+	want := []string{
+		"/blog/deeper/ on /blog/deep/",
+		"/images/diagram.png on /blog/workflow/",
+		"/missing/ on /",
+		"/missing/ on /blog/encyclopedia/",
+		"/tags/go/ on /blog/",
+		"EXTERNAL/gone on /blog/workflow/",
+	}
+	if !slices.Equal(broken, want) {
+		t.Fatalf("broken links:\n%s\nwant:\n%s", strings.Join(broken, "\n"), strings.Join(want, "\n"))
+	}
+
+	if r := results["/private/notes.html"]; !r.Disallowed || r.Broken() {
+		t.Errorf("private page not reported as disallowed: %+v", r)
+	}
+	if r := results["EXTERNAL/docs"]; r.StatusCode != http.StatusOK {
+		t.Errorf("external link: %+v", r)
+	}
+	if _, ok := results["/commented-out/"]; ok {
+		t.Error("followed a link inside a comment")
+	}
+
+	// every url was fetched once, however many pages link to it
+	served := site.served()
+	seen := make(map[string]bool)
+	for _, path := range served {
+		if seen[path] {
+			t.Errorf("%s fetched more than once", path)
+		}
+		seen[path] = true
+	}
+	if seen["/private/notes.html"] {
+		t.Error("fetched a page disallowed by robots.txt")
+	}
+	if !seen["/robots.txt"] {
+		t.Error("robots.txt was not fetched")
+	}
+}
+
+func TestCrawlMaxDepth(t *testing.T) {
+	site, external := newSite(t)
+
+	// the root is at depth 0 and /blog/deep/ at depth 2, so its links are not followed
+	c := &Crawler{Concurrency: 2, MaxDepth: 2, External: true}
+	_, results := crawl(t, c, site, external)
+
+	if r, ok := results["/blog/deep/"]; !ok || r.Depth != 2 {
+		t.Fatalf("/blog/deep/ not checked at depth 2: %+v", r)
+	}
+	if _, ok := results["/blog/deeper/"]; ok {
+		t.Fatal("followed a link beyond the maximum depth")
+	}
+}
+
+func TestCrawlSameHost(t *testing.T) {
+	site, external := newSite(t)
+
+	c := &Crawler{Concurrency: 2}
+	broken, _ := crawl(t, c, site, external)
+
+	if served := external.served(); len(served) > 0 {
+		t.Fatalf("external host was requested: %v", served)
+	}
+	for _, b := range broken {
+		if strings.HasPrefix(b, "EXTERNAL") {
+			t.Fatalf("external link reported: %s", b)
+		}
+	}
+}
+
+func TestCrawlPoliteness(t *testing.T) {
+	site, external := newSite(t)
+
+	const delay = 20 * time.Millisecond
+	c := &Crawler{Concurrency: 8, Delay: delay}
+	crawl(t, c, site, external)
+
+	site.mu.Lock()
+	defer site.mu.Unlock()
+
+	// robots.txt is fetched before the delay applies
+	times := site.times[1:]
+	if len(times) < 5 {
+		t.Fatalf("only %d requests", len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < delay {
+			t.Errorf("requests %d and %d only %v apart", i-1, i, gap)
+		}
+	}
+}
+
+func TestCrawlCancel(t *testing.T) {
+	site, _ := newSite(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Crawler{Concurrency: 2, Delay: time.Second}
+	results := c.Crawl(ctx, site.URL)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for range results {
+		}
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second / 2):
+		t.Fatal("results were not closed after cancellation")
+	}
+}
+
+func TestRobots(t *testing.T) {
+	r := parseRobots(strings.NewReader(`
+# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public/
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+
+User-agent: other-bot
+User-agent: link-checker
+Disallow: /
+Allow: /blog
+`), "")
+
+	for path, want := range map[string]bool{
+		"/":                     true,
+		"/private/":             false,
+		"/private/notes.html":   false,
+		"/private/public/a":     true,
+		"/papers/paper.pdf":     false,
+		"/papers/paper.pdf.txt": true,
+	} {
+		if got := r.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if r.crawlDelay != 1500*time.Millisecond {
+		t.Errorf("crawl delay %v", r.crawlDelay)
+	}
+
+	r = parseRobots(strings.NewReader("User-agent: other-bot\nUser-agent: link-checker\nDisallow: /\nAllow: /blog\n"), "link-checker/1.0")
+	if r.allowed("/about/") || !r.allowed("/blog/workflow/") {
+		t.Error("rules for our user agent were not applied")
+	}
+
+	// an empty disallow allows everything
+	r = parseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), "")
+	if !r.allowed("/anything") {
+		t.Error("empty disallow blocked a path")
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	base, _ := url.Parse("http://example.com:80/blog/post/")
+	links := extractLinks(base, `
+<a href="../other/#section">relative</a>
+<A HREF='/single'>single quotes</A>
+<img alt="x" src=/unquoted.png>
+<a href="/search?q=a&amp;page=2">entities</a>
+<!-- <a href="/commented/">hidden</a> -->
+<a href="mailto:someone@example.com">mail</a>
+<a href="https://other.example.com:443">other host</a>
+<base href="http://example.com/docs/">
+<a href="guide">after base</a>
+`)
+
+	want := []string{
+		"http://example.com/blog/other/",
+		"http://example.com/single",
+		"http://example.com/unquoted.png",
+		"http://example.com/search?q=a&page=2",
+		"https://other.example.com/",
+		"http://example.com/docs/guide",
+	}
+	if !slices.Equal(links, want) {
+		t.Fatalf("got\n%s\nwant\n%s", strings.Join(links, "\n"), strings.Join(want, "\n"))
+	}
+}
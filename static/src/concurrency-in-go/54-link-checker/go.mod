@@ -0,0 +1,3 @@
+module m54
+
+go 1.22.5
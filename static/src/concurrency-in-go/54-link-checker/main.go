@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// siteHandler serves the fixture site in dir; HOST in a page is replaced by the host of the request and EXTERNAL by the given url
+func siteHandler(dir, external string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+
+		info, err := os.Stat(file)
+		if err == nil && info.IsDir() {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if filepath.Ext(file) == ".html" {
+			data = []byte(strings.NewReplacer("HOST", r.Host, "EXTERNAL", external).Replace(string(data)))
+		}
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(data))
+	})
+}
+
+func main() {
+	// check the given site, e.g. one served by `hugo server`, or the fixture site
+	var root string
+	if len(os.Args) > 1 {
+		root = os.Args[1]
+	} else {
+		external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/gone" {
+				w.WriteHeader(http.StatusGone)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		}))
+		defer external.Close()
+
+		site := httptest.NewServer(siteHandler("testdata/site", external.URL))
+		defer site.Close()
+		root = site.URL + "/"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	crawler := &Crawler{
+		UserAgent:   "link-checker",
+		Concurrency: 4,
+		Delay:       10 * time.Millisecond,
+		MaxDepth:    5,
+		External:    true,
+	}
+
+	start := time.Now()
+	checked := make(map[string]bool)
+	broken := 0
+	for r := range crawler.Crawl(ctx, root) {
+		// a broken link is reported once more for every other page it is found on
+		if checked[r.URL] {
+			for _, page := range r.Pages {
+				fmt.Printf("broken   %s on %s\n", r.URL, page)
+			}
+			continue
+		}
+		checked[r.URL] = true
+
+		switch {
+		case r.Disallowed:
+			fmt.Printf("skipped  %s (robots.txt)\n", r.URL)
+		case r.Broken():
+			broken++
+			status := fmt.Sprint(r.StatusCode)
+			if r.Err != nil {
+				status = r.Err.Error()
+			}
+			for _, page := range r.Pages {
+				fmt.Printf("broken   %s on %s: %s\n", r.URL, page, status)
+			}
+			if len(r.Pages) == 0 {
+				fmt.Printf("broken   %s: %s\n", r.URL, status)
+			}
+		}
+	}
+	fmt.Printf("checked %d links in %v, %d broken\n", len(checked), time.Since(start).Round(time.Millisecond), broken)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robots.txt is made of groups: one or more User-agent lines followed by the rules for those agents; a crawler obeys the group naming it, or the * group if none does
+
+// among the rules matching a path the longest one wins, and allow wins a tie; * in a rule matches any sequence of characters and a trailing $ anchors the rule to the end of the path
+
+type rule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robots struct {
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// allowAll is used when a host has no robots.txt
+var allowAll = &robots{}
+
+func (r *robots) allowed(path string) bool {
+	best := -1
+	allow := true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best, allow = rule.length, rule.allow
+		}
+	}
+	return allow
+}
+
+func compileRule(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range strings.Split(path, "*") {
+		if i > 0 {
+			b.WriteString(".*")
+		}
+		b.WriteString(regexp.QuoteMeta(part))
+	}
+	if anchored {
+		b.WriteString("$")
+	}
+	return regexp.MustCompile(b.String())
+}
+
+// parseRobots returns the rules in r that apply to userAgent
+func parseRobots(r io.Reader, userAgent string) *robots {
+	type group struct {
+		agents []string
+		robots robots
+	}
+
+	var groups []*group
+	var current *group
+	inAgents := false // the previous line was a User-agent line
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			// an empty disallow allows everything
+			if current != nil && value != "" {
+				current.robots.rules = append(current.robots.rules, rule{
+					allow:   key == "allow",
+					length:  len(value),
+					pattern: compileRule(value),
+				})
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && current != nil {
+				current.robots.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		inAgents = false
+	}
+
+	// the most specific group wins: one naming us, otherwise the wildcard
+	agent := strings.ToLower(userAgent)
+	var wildcard *robots
+	for _, g := range groups {
+		for _, a := range g.agents {
+			switch {
+			case a == "*":
+				if wildcard == nil {
+					wildcard = &g.robots
+				}
+			case a != "" && strings.Contains(agent, a):
+				return &g.robots
+			}
+		}
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return allowAll
+}
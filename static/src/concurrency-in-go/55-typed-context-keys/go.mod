@@ -0,0 +1,3 @@
+module m55
+
+go 1.22.5
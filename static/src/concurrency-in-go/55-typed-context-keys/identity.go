@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// identity travels between services in headers and within a service in the context: the middleware moves it from the headers of an incoming request into the context, and the transport moves it from the context of an outgoing request back into headers
+
+// a request id is created by the first service a request reaches and then passed along unchanged, so the logs of every service a request touched can be tied together
+
+// the middleware only sets the values it finds, so a handler can tell an anonymous request from one whose user id is empty
+
+var (
+	UserId    = NewKey[string]("userId")
+	AuthToken = NewKey[string]("authToken")
+	RequestId = NewKey[string]("requestId")
+)
+
+const (
+	userIdHeader    = "X-User-Id"
+	requestIdHeader = "X-Request-Id"
+)
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Identity loads the user id, auth token and request id of a request into its context
+
+// it does not authenticate anything: X-User-Id is taken from the client as is, so anyone who can reach the service can claim to be any user; it must sit behind an authenticating proxy or gateway that strips X-User-Id from incoming requests and sets it only after verifying the caller
+func Identity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if userId := r.Header.Get(userIdHeader); userId != "" {
+			ctx = UserId.With(ctx, userId)
+		}
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			ctx = AuthToken.With(ctx, token)
+		}
+
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" {
+			requestId = newRequestId()
+		}
+		ctx = RequestId.With(ctx, requestId)
+		w.Header().Set(requestIdHeader, requestId)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Transport sets the identity in the context of a request on its headers, leaving alone headers the caller set itself
+
+// the identity includes the user's auth token, so it is only sent to the internal hosts listed in Hosts; a request to any other host, such as a third party api called while serving a request, goes out without it
+type Transport struct {
+	Transport http.RoundTripper
+	Hosts     []string // host or host:port of the services that receive the identity
+}
+
+func (t *Transport) internal(u *url.URL) bool {
+	for _, host := range t.Hosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if !t.internal(req.URL) {
+		return transport.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	headers := make(map[string]string)
+	if userId, ok := UserId.Get(ctx); ok {
+		headers[userIdHeader] = userId
+	}
+	if token, ok := AuthToken.Get(ctx); ok {
+		headers["Authorization"] = "Bearer " + token
+	}
+	if requestId, ok := RequestId.Get(ctx); ok {
+		headers[requestIdHeader] = requestId
+	}
+
+	// a RoundTripper must not modify the request it was given
+	out := req
+	for name, value := range headers {
+		if req.Header.Get(name) != "" {
+			continue
+		}
+		if out == req {
+			out = req.Clone(ctx)
+		}
+		out.Header.Set(name, value)
+	}
+	return transport.RoundTrip(out)
+}
+
+type Result struct {
+	Err      error
+	Response *http.Response
+}
+
+// fetchAll takes a context rather than a done channel so that the identity of the request being served goes along with every call
+func fetchAll(ctx context.Context, client *http.Client, urls ...string) <-chan Result {
+	results := make(chan Result)
+	go func() {
+		defer close(results)
+
+		for _, url := range urls {
+			var result Result
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err == nil {
+				result.Response, result.Err = client.Do(req)
+			} else {
+				result.Err = err
+			}
+			select {
+			case <-ctx.Done():
+				if result.Response != nil {
+					result.Response.Body.Close()
+				}
+				return
+			case results <- result:
+			}
+		}
+	}()
+
+	return results
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// ctx.Value returns an any, so every accessor has to assert the type of the value and decide what to do when it is missing; asserting with a single result panics on a request that skipped the middleware setting the value
+
+// a Key[T] carries the type of its value, so the assertion lives in one place and callers choose between checking for a missing value, falling back to a default and panicking with a message that names the key
+
+// each key is a distinct pointer, so two keys never collide even when they have the same name and type, and code outside the package cannot forge one
+
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return fmt.Sprintf("%s (%v)", k.name, reflect.TypeFor[T]())
+}
+
+// With returns a copy of ctx carrying v under k
+func (k *Key[T]) With(ctx context.Context, v T) context.Context {
+	return &valueCtx{Context: ctx, key: k, val: v}
+}
+
+// Get returns the value of k in ctx and whether it was set
+func (k *Key[T]) Get(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k).(T)
+	return v, ok
+}
+
+// MustGet returns the value of k in ctx, panicking if it was not set; use it only where a missing value is a programming error
+func (k *Key[T]) MustGet(ctx context.Context) T {
+	v, ok := k.Get(ctx)
+	if !ok {
+		panic(fmt.Sprintf("context has no value for %v; keys set: %v", k, Keys(ctx)))
+	}
+	return v
+}
+
+// GetOr returns the value of k in ctx, or def if it was not set
+func (k *Key[T]) GetOr(ctx context.Context, def T) T {
+	if v, ok := k.Get(ctx); ok {
+		return v
+	}
+	return def
+}
+
+// chainKey finds the nearest valueCtx in a chain of contexts
+type chainKey struct{}
+
+// valueCtx is like the context returned by context.WithValue, but can also be found by Keys
+type valueCtx struct {
+	context.Context
+	key fmt.Stringer
+	val any
+}
+
+func (c *valueCtx) Value(key any) any {
+	switch key {
+	case c.key:
+		return c.val
+	case chainKey{}:
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// String leaves out the value, which may be a secret such as an auth token
+func (c *valueCtx) String() string {
+	return fmt.Sprintf("%v.WithValue(%v)", c.Context, c.key)
+}
+
+// Keys lists the typed keys set on ctx and its parents, nearest first; a key set more than once is listed once
+func Keys(ctx context.Context) []string {
+	var keys []string
+	seen := make(map[fmt.Stringer]bool)
+	for c, ok := ctx.Value(chainKey{}).(*valueCtx); ok; c, ok = c.Context.Value(chainKey{}).(*valueCtx) {
+		if !seen[c.key] {
+			seen[c.key] = true
+			keys = append(keys, c.key.String())
+		}
+	}
+	return keys
+}
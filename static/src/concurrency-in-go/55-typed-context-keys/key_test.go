@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyGet(t *testing.T) {
+	name := NewKey[string]("name")
+	ctx := context.Background()
+
+	if v, ok := name.Get(ctx); ok || v != "" {
+		t.Fatalf("got %q, %v from empty context", v, ok)
+	}
+	if v := name.GetOr(ctx, "default"); v != "default" {
+		t.Fatalf("GetOr returned %q", v)
+	}
+
+	ctx = name.With(ctx, "jane")
+	if v, ok := name.Get(ctx); !ok || v != "jane" {
+		t.Fatalf("got %q, %v", v, ok)
+	}
+	if v := name.GetOr(ctx, "default"); v != "jane" {
+		t.Fatalf("GetOr returned %q", v)
+	}
+
+	// a nearer value shadows a farther one
+	ctx = name.With(ctx, "john")
+	if v := name.MustGet(ctx); v != "john" {
+		t.Fatalf("MustGet returned %q", v)
+	}
+}
+
+func TestKeysDoNotCollide(t *testing.T) {
+	a := NewKey[string]("id")
+	b := NewKey[string]("id")
+	n := NewKey[int]("id")
+
+	ctx := a.With(context.Background(), "a")
+	if _, ok := b.Get(ctx); ok {
+		t.Fatal("key with the same name and type saw another key's value")
+	}
+	if _, ok := n.Get(ctx); ok {
+		t.Fatal("key with the same name saw another key's value")
+	}
+}
+
+func TestKeyThroughDerivedContexts(t *testing.T) {
+	type plainKey struct{}
+	name := NewKey[string]("name")
+	count := NewKey[int]("count")
+
+	ctx := name.With(context.Background(), "jane")
+	ctx = context.WithValue(ctx, plainKey{}, "plain")
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	ctx = count.With(ctx, 3)
+	ctx = context.WithoutCancel(ctx)
+
+	if v := name.MustGet(ctx); v != "jane" {
+		t.Fatalf("got %q", v)
+	}
+	if v := count.MustGet(ctx); v != 3 {
+		t.Fatalf("got %d", v)
+	}
+	if v := ctx.Value(plainKey{}); v != "plain" {
+		t.Fatalf("plain value lost: %v", v)
+	}
+}
+
+func TestKeyCancellation(t *testing.T) {
+	name := NewKey[string]("name")
+
+	parent, cancel := context.WithCancel(context.Background())
+	child, childCancel := context.WithCancel(name.With(parent, "jane"))
+	defer childCancel()
+
+	cancel()
+	select {
+	case <-child.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cancellation did not propagate through a typed value")
+	}
+}
+
+func TestMustGetPanics(t *testing.T) {
+	name := NewKey[string]("name")
+	token := NewKey[string]("token")
+	ctx := token.With(context.Background(), "secret")
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "name (string)") || !strings.Contains(msg, "token (string)") {
+			t.Fatalf("unexpected panic %q", msg)
+		}
+		if strings.Contains(msg, "secret") {
+			t.Fatalf("panic message leaks a value: %q", msg)
+		}
+	}()
+	name.MustGet(ctx)
+}
+
+func TestKeys(t *testing.T) {
+	name := NewKey[string]("name")
+	count := NewKey[int]("count")
+
+	if keys := Keys(context.Background()); len(keys) != 0 {
+		t.Fatalf("got %v from empty context", keys)
+	}
+
+	ctx := name.With(context.Background(), "jane")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = count.With(ctx, 1)
+	ctx = name.With(ctx, "john")
+
+	want := []string{"name (string)", "count (int)"}
+	if keys := Keys(ctx); !slices.Equal(keys, want) {
+		t.Fatalf("got %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// ProcessRequest sends a request on behalf of a user; the services it reaches build their contexts from its headers
+func ProcessRequest(url, userId, authToken string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if userId != "" {
+		req.Header.Set(userIdHeader, userId)
+	}
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	fmt.Printf("request %s:\n%s\n", response.Header.Get(requestIdHeader), body)
+}
+
+func HandleResponse(ctx context.Context) string {
+	userId, ok := UserId.Get(ctx)
+	if !ok {
+		// a request that skipped the authentication middleware no longer crashes the handler
+		return fmt.Sprintf("no user on request %s; keys set: %v", RequestId.MustGet(ctx), Keys(ctx))
+	}
+	return fmt.Sprintf("handling response for %v (%v) in request %v", userId, AuthToken.GetOr(ctx, "anonymous"), RequestId.MustGet(ctx))
+}
+
+func main() {
+	backend := httptest.NewServer(Identity(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "  backend %s: %s\n", r.URL.Path, HandleResponse(r.Context()))
+	})))
+	defer backend.Close()
+
+	// a third party must never see the user's credentials
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "  external: authorization %q, user %q\n", r.Header.Get("Authorization"), r.Header.Get(userIdHeader))
+	}))
+	defer external.Close()
+
+	// the frontend calls the backend with the identity of the request it is serving
+	client := &http.Client{Transport: &Transport{Hosts: []string{backend.Listener.Addr().String()}}}
+	frontend := httptest.NewServer(Identity(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "  frontend: %s\n", HandleResponse(r.Context()))
+
+		for result := range fetchAll(r.Context(), client, backend.URL+"/profile", backend.URL+"/orders", external.URL) {
+			if result.Err != nil {
+				fmt.Fprintf(w, "  error: %v\n", result.Err)
+				continue
+			}
+			io.Copy(w, result.Response.Body)
+			result.Response.Body.Close()
+		}
+	})))
+	defer frontend.Close()
+
+	ProcessRequest(frontend.URL, "jane", "123")
+	ProcessRequest(frontend.URL, "", "")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// when a server is overloaded, rejecting some requests quickly is better than accepting all of them and answering every one too late
+
+// a bulkhead isolates a group of routes: it admits at most MaxConcurrent requests at a time and lets at most QueueLength more wait, so a slow group cannot tie up every goroutine and connection of the server while the other groups stay responsive
+
+// a request is shed when its bulkhead's queue is full, in which case the client is told when to retry, and when it is still waiting for a slot once its deadline has passed; the client's deadline never reaches the server, so each bulkhead sets its own with MaxWait, and a client that disconnects while waiting is shed as well since nobody is left to read the answer
+
+type Settings struct {
+	MaxConcurrent int           // requests running at once
+	QueueLength   int           // requests waiting for a slot beyond MaxConcurrent
+	MaxWait       time.Duration // how long a request may wait for a slot; zero means until the client gives up
+}
+
+type Bulkhead struct {
+	prefix   string
+	settings Settings
+
+	queue chan struct{} // admitted requests, running or waiting
+	slots chan struct{} // running requests
+
+	rejected atomic.Int64 // shed because the queue was full
+	expired  atomic.Int64 // shed because the deadline passed or the client went away
+}
+
+func NewBulkhead(prefix string, settings Settings) *Bulkhead {
+	if settings.MaxConcurrent <= 0 {
+		panic("MaxConcurrent must be positive")
+	}
+	if settings.QueueLength < 0 {
+		panic("QueueLength must not be negative")
+	}
+	return &Bulkhead{
+		prefix:   prefix,
+		settings: settings,
+		queue:    make(chan struct{}, settings.MaxConcurrent+settings.QueueLength),
+		slots:    make(chan struct{}, settings.MaxConcurrent),
+	}
+}
+
+const retryAfter = time.Second
+
+func (b *Bulkhead) shedExpired(w http.ResponseWriter) {
+	b.expired.Add(1)
+	http.Error(w, "request expired", http.StatusServiceUnavailable)
+}
+
+func (b *Bulkhead) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	select {
+	case b.queue <- struct{}{}:
+		defer func() { <-b.queue }()
+	default:
+		b.rejected.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		http.Error(w, "server overloaded", http.StatusServiceUnavailable)
+		return
+	}
+
+	// the deadline only bounds the wait; once a request has a slot it runs to completion under the client's context
+	wait := r.Context()
+	if b.settings.MaxWait > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(wait, b.settings.MaxWait)
+		defer cancel()
+	}
+	if wait.Err() != nil {
+		b.shedExpired(w)
+		return
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		defer func() { <-b.slots }()
+	case <-wait.Done():
+		b.shedExpired(w)
+		return
+	}
+
+	// the deadline may have passed at the same moment a slot became free
+	if wait.Err() != nil {
+		b.shedExpired(w)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// matches reports whether path is in the route group, so that /api covers /api and /api/users but not /apiary
+func (b *Bulkhead) matches(path string) bool {
+	rest, ok := strings.CutPrefix(path, b.prefix)
+	return ok && (rest == "" || strings.HasSuffix(b.prefix, "/") || rest[0] == '/')
+}
+
+// Shed routes each request through the bulkhead of its route group, the one with the longest matching prefix; requests outside every group are not limited
+func Shed(next http.Handler, bulkheads ...*Bulkhead) http.Handler {
+	bulkheads = slices.Clone(bulkheads)
+	slices.SortFunc(bulkheads, func(a, b *Bulkhead) int { return len(b.prefix) - len(a.prefix) })
+	for i := 1; i < len(bulkheads); i++ {
+		if bulkheads[i].prefix == bulkheads[i-1].prefix {
+			panic(fmt.Sprintf("duplicate bulkhead for %q", bulkheads[i].prefix))
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, b := range bulkheads {
+			if b.matches(r.URL.Path) {
+				b.serve(w, r, next)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Metrics writes the state of every bulkhead in the prometheus text format
+func Metrics(bulkheads ...*Bulkhead) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# TYPE bulkhead_in_flight gauge")
+		for _, b := range bulkheads {
+			fmt.Fprintf(w, "bulkhead_in_flight{bulkhead=%q} %d\n", b.prefix, len(b.slots))
+		}
+		fmt.Fprintln(w, "# TYPE bulkhead_queued gauge")
+		for _, b := range bulkheads {
+			fmt.Fprintf(w, "bulkhead_queued{bulkhead=%q} %d\n", b.prefix, max(len(b.queue)-len(b.slots), 0))
+		}
+		fmt.Fprintln(w, "# TYPE bulkhead_shed_total counter")
+		for _, b := range bulkheads {
+			fmt.Fprintf(w, "bulkhead_shed_total{bulkhead=%q,reason=\"queue_full\"} %d\n", b.prefix, b.rejected.Load())
+			fmt.Fprintf(w, "bulkhead_shed_total{bulkhead=%q,reason=\"expired\"} %d\n", b.prefix, b.expired.Load())
+		}
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingServer serves every path through a handler that blocks until release is closed, and the metrics of the bulkheads on /metrics; entered receives the path of every request that got past its bulkhead
+func blockingServer(t *testing.T, bulkheads ...*Bulkhead) (server *httptest.Server, entered chan string, release chan struct{}) {
+	entered = make(chan string, 10)
+	release = make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- r.URL.Path
+		<-release
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Metrics(bulkheads...))
+	mux.Handle("/", Shed(handler, bulkheads...))
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, entered, release
+}
+
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+	}
+	return response, err
+}
+
+// metric returns the value of the metric with the given name and labels
+func metric(t *testing.T, url, name string) string {
+	t.Helper()
+	response, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, name+" "); ok {
+			return value
+		}
+	}
+	t.Fatalf("no metric %s in\n%s", name, body)
+	return ""
+}
+
+// waitFor polls the metric until it has the given value
+func waitFor(t *testing.T, url, name, value string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for metric(t, url, name) != value {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is %s, want %s", name, metric(t, url, name), value)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadShedsWhenQueueFull(t *testing.T) {
+	server, entered, release := blockingServer(t, NewBulkhead("/api", Settings{MaxConcurrent: 1, QueueLength: 1}), NewBulkhead("/static", Settings{MaxConcurrent: 1}))
+
+	results := make(chan int, 2)
+	for range 2 {
+		go func() {
+			response, err := get(context.Background(), server.URL+"/api/slow")
+			if err != nil {
+				t.Error(err)
+				results <- 0
+				return
+			}
+			results <- response.StatusCode
+		}()
+	}
+
+	// one request runs and the other waits in the queue
+	<-entered
+	waitFor(t, server.URL, `bulkhead_queued{bulkhead="/api"}`, "1")
+
+	response, err := get(context.Background(), server.URL+"/api/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") != "1" {
+		t.Fatalf("got %s with Retry-After %q, want 503 with Retry-After 1", response.Status, response.Header.Get("Retry-After"))
+	}
+
+	// a full /api group does not affect other routes
+	go get(context.Background(), server.URL+"/static/style.css")
+	if path := <-entered; path != "/static/style.css" {
+		t.Fatalf("%s entered, want /static/style.css", path)
+	}
+	close(release)
+
+	for range 2 {
+		if code := <-results; code != http.StatusOK {
+			t.Fatalf("queued request got %d", code)
+		}
+	}
+
+	if v := metric(t, server.URL, `bulkhead_shed_total{bulkhead="/api",reason="queue_full"}`); v != "1" {
+		t.Errorf("/api queue_full %s, want 1", v)
+	}
+	if v := metric(t, server.URL, `bulkhead_shed_total{bulkhead="/static",reason="queue_full"}`); v != "0" {
+		t.Errorf("/static queue_full %s, want 0", v)
+	}
+}
+
+func TestBulkheadShedsAbandonedRequests(t *testing.T) {
+	server, entered, release := blockingServer(t, NewBulkhead("/api", Settings{MaxConcurrent: 1, QueueLength: 1}))
+	defer close(release)
+
+	go get(context.Background(), server.URL+"/api/slow")
+	<-entered
+
+	// the queued request gives up before a slot frees
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := get(ctx, server.URL+"/api/slow"); err == nil {
+		t.Fatal("expected the queued request to time out")
+	}
+
+	waitFor(t, server.URL, `bulkhead_shed_total{bulkhead="/api",reason="expired"}`, "1")
+	if v := metric(t, server.URL, `bulkhead_shed_total{bulkhead="/api",reason="queue_full"}`); v != "0" {
+		t.Errorf("queue_full %s, want 0", v)
+	}
+}
+
+func TestBulkheadShedsAfterMaxWait(t *testing.T) {
+	server, entered, release := blockingServer(t, NewBulkhead("/api", Settings{MaxConcurrent: 1, QueueLength: 1, MaxWait: 50 * time.Millisecond}))
+	defer close(release)
+
+	go get(context.Background(), server.URL+"/api/slow")
+	<-entered
+
+	// the client is willing to wait, but the bulkhead is not
+	start := time.Now()
+	response, err := get(context.Background(), server.URL+"/api/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") != "" {
+		t.Fatalf("got %s with Retry-After %q, want 503 without Retry-After", response.Status, response.Header.Get("Retry-After"))
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("shed after %v, before MaxWait", elapsed)
+	}
+	if v := metric(t, server.URL, `bulkhead_shed_total{bulkhead="/api",reason="expired"}`); v != "1" {
+		t.Errorf("expired %s, want 1", v)
+	}
+}
+
+func TestBulkheadMatchesWholeSegments(t *testing.T) {
+	b := NewBulkhead("/api", Settings{MaxConcurrent: 1})
+	for path, want := range map[string]bool{
+		"/api":       true,
+		"/api/":      true,
+		"/api/users": true,
+		"/apiary":    false,
+		"/":          false,
+	} {
+		if got := b.matches(path); got != want {
+			t.Errorf("/api matches %q = %v, want %v", path, got, want)
+		}
+	}
+	if !NewBulkhead("/static/", Settings{MaxConcurrent: 1}).matches("/static/style.css") {
+		t.Error("/static/ does not match /static/style.css")
+	}
+}
+
+func TestLongestPrefixWins(t *testing.T) {
+	server, entered, release := blockingServer(t, NewBulkhead("/api", Settings{MaxConcurrent: 1}), NewBulkhead("/api/admin", Settings{MaxConcurrent: 1}))
+	defer close(release)
+
+	go get(context.Background(), server.URL+"/api/users")
+	<-entered
+
+	// /api is full, but /api/admin has its own bulkhead
+	go get(context.Background(), server.URL+"/api/admin/users")
+	if path := <-entered; path != "/api/admin/users" {
+		t.Fatalf("%s entered, want /api/admin/users", path)
+	}
+}
+
+func TestDuplicateBulkheadPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	Shed(http.NotFoundHandler(), NewBulkhead("/api", Settings{MaxConcurrent: 1}), NewBulkhead("/api", Settings{MaxConcurrent: 2}))
+}
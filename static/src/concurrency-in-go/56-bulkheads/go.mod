@@ -0,0 +1,3 @@
+module m56
+
+go 1.22.5
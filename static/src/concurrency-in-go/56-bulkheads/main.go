@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+func main() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	api := NewBulkhead("/api/", Settings{MaxConcurrent: 2, QueueLength: 3, MaxWait: 150 * time.Millisecond})
+	static := NewBulkhead("/static/", Settings{MaxConcurrent: 10, QueueLength: 10})
+
+	root := http.NewServeMux()
+	root.Handle("/metrics", Metrics(api, static))
+	root.Handle("/", Shed(mux, api, static))
+
+	server := httptest.NewServer(root)
+	defer server.Close()
+
+	// requests 0 and 1 run, 2 to 4 wait and the rest are turned away; 2 and 3 get a slot once 0 and 1 finish, but 4 would have to wait another 100ms and is shed when MaxWait runs out
+	var wg sync.WaitGroup
+	for i := 0; i < 7; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+
+			response, err := http.Get(server.URL + "/api/slow")
+			if err != nil {
+				fmt.Printf("request %d: %v\n", i, err)
+				return
+			}
+			body, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			fmt.Printf("request %d: %s retry-after=%q %s", i, response.Status, response.Header.Get("Retry-After"), body)
+		}()
+	}
+	wg.Wait()
+
+	// the static routes are unaffected by the slow api
+	response, err := http.Get(server.URL + "/static/style.css")
+	if err == nil {
+		response.Body.Close()
+		fmt.Println("static:", response.Status)
+	}
+
+	response, err = http.Get(server.URL + "/metrics")
+	if err == nil {
+		metrics, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		fmt.Print(string(metrics))
+	}
+}